@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
@@ -99,6 +100,81 @@ func HandleJoke(c *gin.Context) {
 	c.AbortWithStatusJSON(http.StatusOK, response)
 }
 
+var upgrader = sdk.Upgrader{}
+
+// HandleEcho echoes the messages of a WebSocket connection.
+func HandleEcho(c *gin.Context) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("Error upgrading connection: %v\n", err)
+		return
+	}
+	defer conn.Close()
+
+	for {
+		messageType, p, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := conn.WriteMessage(messageType, p); err != nil {
+			return
+		}
+	}
+}
+
+// HandleClock streams the time as server-sent events until the client goes away.
+func HandleClock(c *gin.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for i := 0; i < 10; i++ {
+		c.SSEvent("time", time.Now().Format(time.RFC3339))
+		c.Writer.Flush()
+
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// HandleHeartbeat is invoked by the heartbeat cron trigger.
+func HandleHeartbeat(c *gin.Context) {
+	inv, ok := sdk.InvocationFromContext(c.Request.Context())
+	if !ok || inv.Event == nil {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	log.Printf("Heartbeat due at %s: %s\n", inv.Event.Time.Format(time.RFC3339), inv.Event.Data)
+	c.Status(http.StatusNoContent)
+}
+
+// HandleNewJob enqueues the request body as a job, which HandleJob processes later.
+func HandleNewJob(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if err := sdk.Enqueue("jobs", body); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// HandleJob is invoked with the messages of the jobs queue.
+func HandleJob(c *gin.Context) {
+	inv, ok := sdk.InvocationFromContext(c.Request.Context())
+	if !ok || inv.Event == nil {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	log.Printf("Job %s, attempt %s: %s\n", inv.Event.ID, inv.Event.Attributes["attempt"], inv.Event.Data)
+	c.Status(http.StatusNoContent)
+}
+
 func main() {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
@@ -115,5 +191,13 @@ func main() {
 		return
 	})
 	v1.GET("/joke", HandleJoke)
-	sdk.Handle(router, nil) // nil will use os.Stdin as fallback
+	v1.GET("/echo", HandleEcho)
+	v1.GET("/clock", HandleClock)
+	v1.POST("/heartbeat", HandleHeartbeat)
+	v1.POST("/jobs/new", HandleNewJob)
+	v1.POST("/jobs", HandleJob)
+	// Serves locally when not built for wasip1. Built with the ignis_hostio
+	// tag, as the Makefile does, the request and response go through the
+	// host's functions and stdout is left to logs.
+	sdk.Handle(router, nil)
 }
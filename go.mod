@@ -1,8 +1,6 @@
 module github.com/ASparkOfFire/ignis
 
-go 1.23.0
-
-toolchain go1.24.0
+go 1.24.0
 
 replace (
 	github.com/ignis-runtime/net => ../libs/net
@@ -13,11 +11,14 @@ replace (
 
 require (
 	github.com/breml/rootcerts v0.3.1
+	github.com/fxamacker/cbor/v2 v2.7.0
 	github.com/gin-gonic/gin v1.10.0
 	github.com/google/uuid v1.6.0
+	github.com/gorilla/websocket v1.5.3
 	github.com/ignis-runtime/net v0.0.0-00010101000000-000000000000
 	github.com/ignis-runtime/wasi-go v0.0.0-00010101000000-000000000000
 	github.com/ignis-runtime/wazero v1.9.0
+	golang.org/x/sys v0.30.0
 	google.golang.org/protobuf v1.36.5
 )
 
@@ -40,6 +41,7 @@ require (
 	github.com/pelletier/go-toml/v2 v2.2.3 // indirect
 	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
 	github.com/ugorji/go/codec v1.2.12 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
 	golang.org/x/arch v0.14.0 // indirect
 	golang.org/x/crypto v0.34.0 // indirect
 	golang.org/x/net v0.35.0 // indirect
@@ -47,7 +49,4 @@ require (
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
-require (
-	github.com/mattn/go-isatty v0.0.20 // indirect
-	golang.org/x/sys v0.30.0 // indirect
-)
+require github.com/mattn/go-isatty v0.0.20 // indirect
@@ -1,6 +1,12 @@
 package cache
 
 import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
 	"github.com/ignis-runtime/wazero"
 )
 
@@ -10,35 +16,281 @@ type Cacher[K comparable] interface {
 	Add(K, wazero.CompilationCache)
 	Has(K) bool
 	Remove(K)
+	GetOrCreate(K) (wazero.CompilationCache, func(), error)
+	Do(K, func() error) (bool, error)
+	// SetSize records the size of the modules compiled into the cache of a
+	// key, measured by caches that can and estimated as the given size otherwise.
+	SetSize(K, int64)
+}
+
+// Options bounds a ModCache. Zero values mean unbounded.
+type Options struct {
+	MaxEntries int           // Maximum number of cached modules
+	MaxBytes   int64         // Budget for the size of compiled modules, see ModCache.SetSize
+	TTL        time.Duration // Evict modules unused for this long
+}
+
+// Stats reports ModCache activity.
+type Stats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+	Bytes     int64  `json:"bytes"` // Measured or estimated, see ModCache.SetSize
 }
 
-// ModCache wraps SafeMap for thread-safe caching
+// ModCache is a thread-safe LRU of compilation caches. Evicted caches are
+// closed once the last runtime using them releases them.
 type ModCache[K comparable] struct {
-	m *SafeMap[K, wazero.CompilationCache] // Use pointer for proper initialization
+	m        *lru[K]   // Use pointer so copies share state
+	flight   *Group[K] // Deduplicates concurrent compilations
+	newCache func(K) (wazero.CompilationCache, func(), error)
+	measure  func(K) (int64, error) // Sizes compiled modules, nil if they can only be estimated
+}
+
+// lru holds the ModCache state behind a single lock.
+type lru[K comparable] struct {
+	mu      sync.Mutex
+	opts    Options
+	order   *list.List // Front is most recently used
+	entries map[K]*list.Element
+	stats   Stats
 }
 
-// NewModCache initializes a new ModCache
-func NewModCache[K comparable]() ModCache[K] {
+// entry is a cached compilation cache and its bookkeeping.
+type entry[K comparable] struct {
+	key      K
+	cache    wazero.CompilationCache
+	size     int64
+	refs     int
+	lastUsed time.Time
+	evicted  bool
+	measured bool   // size was measured, and keys name content, so it is final
+	done     func() // Called once cache is closed, if not nil
+}
+
+// NewModCache initializes a new ModCache holding compiled modules in memory
+func NewModCache[K comparable](opts Options) ModCache[K] {
 	return ModCache[K]{
-		m: NewSafeMap[K, wazero.CompilationCache](), // Properly initialize SafeMap
+		m:      newLRU[K](opts),
+		flight: new(Group[K]),
+		newCache: func(K) (wazero.CompilationCache, func(), error) {
+			return wazero.NewCompilationCache(), nil, nil
+		},
+	}
+}
+
+// NewDirModCache initializes a new ModCache persisting compiled modules in dir
+func NewDirModCache[K comparable](dir *DirCache, opts Options) ModCache[K] {
+	return ModCache[K]{
+		m:      newLRU[K](opts),
+		flight: new(Group[K]),
+		newCache: func(key K) (wazero.CompilationCache, func(), error) {
+			return dir.CompilationCache(fmt.Sprint(key))
+		},
+		measure: func(key K) (int64, error) {
+			return dir.EntrySize(fmt.Sprint(key))
+		},
+	}
+}
+
+func newLRU[K comparable](opts Options) *lru[K] {
+	return &lru[K]{
+		opts:    opts,
+		order:   list.New(),
+		entries: make(map[K]*list.Element),
 	}
 }
 
-// Get retrieves a CompilationCache from SafeMap
+// Get retrieves a CompilationCache and marks it as recently used
 func (mc *ModCache[K]) Get(key K) wazero.CompilationCache {
-	return mc.m.Get(key)
+	mc.m.mu.Lock()
+	defer mc.m.mu.Unlock()
+
+	e := mc.m.touch(key)
+	if e == nil {
+		return nil
+	}
+	return e.cache
 }
 
-// Add Set stores a CompilationCache in SafeMap
+// Add stores a CompilationCache, evicting entries that exceed the limits
 func (mc *ModCache[K]) Add(key K, cache wazero.CompilationCache) {
-	mc.m.Add(key, cache)
+	mc.m.mu.Lock()
+	defer mc.m.mu.Unlock()
+
+	if el, ok := mc.m.entries[key]; ok {
+		mc.m.evict(el, false)
+	}
+	e := &entry[K]{key: key, cache: cache, lastUsed: time.Now()}
+	mc.m.entries[key] = mc.m.order.PushFront(e)
+	mc.m.stats.Entries++
+	mc.m.enforce()
 }
 
 func (mc *ModCache[K]) Has(key K) bool {
-	return mc.m.Has(key)
+	mc.m.mu.Lock()
+	defer mc.m.mu.Unlock()
+	_, ok := mc.m.entries[key]
+	return ok
 }
 
-// Remove removes an entry from SafeMap
+// Remove removes an entry, closing its CompilationCache once unused
 func (mc *ModCache[K]) Remove(key K) {
-	mc.m.Remove(key)
+	mc.m.mu.Lock()
+	defer mc.m.mu.Unlock()
+
+	if el, ok := mc.m.entries[key]; ok {
+		mc.m.evict(el, false)
+	}
+}
+
+// GetOrCreate returns the CompilationCache for key, creating it if missing,
+// and a func to call once the runtime using it is closed. Evicted caches stay
+// open until released.
+func (mc *ModCache[K]) GetOrCreate(key K) (wazero.CompilationCache, func(), error) {
+	mc.m.mu.Lock()
+	defer mc.m.mu.Unlock()
+
+	e := mc.m.touch(key)
+	if e == nil {
+		cache, done, err := mc.newCache(key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create compilation cache: %w", err)
+		}
+		e = &entry[K]{key: key, cache: cache, lastUsed: time.Now(), done: done}
+		mc.m.entries[key] = mc.m.order.PushFront(e)
+		mc.m.stats.Entries++
+	}
+	e.refs++
+	mc.m.enforce() // The new entry is the most recently used, so others go first
+
+	l := mc.m
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			e.refs--
+			if e.evicted && e.refs == 0 {
+				e.close()
+			}
+		})
+	}
+	return e.cache, release, nil
+}
+
+// Do runs compile unless a compilation for key is already in flight, in which
+// case it waits for it. shared reports whether another caller compiled.
+func (mc *ModCache[K]) Do(key K, compile func() error) (shared bool, err error) {
+	return mc.flight.Do(key, compile)
+}
+
+// SetSize records the size of the modules compiled into key's cache. Caches
+// persisted in a directory measure their artifacts there, which is the native
+// code wazero loads. In-memory caches cannot be measured, so estimate is used.
+func (mc *ModCache[K]) SetSize(key K, estimate int64) {
+	if mc.measure == nil {
+		mc.setSize(key, estimate, false)
+		return
+	}
+	if mc.m.measured(key) {
+		return
+	}
+	if size, err := mc.measure(key); err == nil {
+		mc.setSize(key, size, true)
+	} else {
+		mc.setSize(key, estimate, false)
+	}
+}
+
+// setSize records the size of key's entry and evicts entries over the limits.
+func (mc *ModCache[K]) setSize(key K, size int64, measured bool) {
+	mc.m.mu.Lock()
+	defer mc.m.mu.Unlock()
+
+	el, ok := mc.m.entries[key]
+	if !ok {
+		return
+	}
+	e := el.Value.(*entry[K])
+	mc.m.stats.Bytes += size - e.size
+	e.size = size
+	e.measured = measured
+	mc.m.enforce()
+}
+
+// Sweep evicts entries that have been unused for longer than the TTL
+func (mc *ModCache[K]) Sweep() {
+	mc.m.mu.Lock()
+	defer mc.m.mu.Unlock()
+	mc.m.enforce()
+}
+
+// Stats returns a snapshot of the cache counters
+func (mc *ModCache[K]) Stats() Stats {
+	mc.m.mu.Lock()
+	defer mc.m.mu.Unlock()
+	return mc.m.stats
+}
+
+// measured reports whether the size of key's entry was measured.
+func (l *lru[K]) measured(key K) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	el, ok := l.entries[key]
+	return ok && el.Value.(*entry[K]).measured
+}
+
+// touch moves key to the front and counts the hit or miss. Callers hold mu.
+func (l *lru[K]) touch(key K) *entry[K] {
+	el, ok := l.entries[key]
+	if !ok {
+		l.stats.Misses++
+		return nil
+	}
+	l.stats.Hits++
+	l.order.MoveToFront(el)
+	e := el.Value.(*entry[K])
+	e.lastUsed = time.Now()
+	return e
+}
+
+// enforce evicts from the back until every limit holds. Callers hold mu.
+func (l *lru[K]) enforce() {
+	for el := l.order.Back(); el != nil; el = l.order.Back() {
+		e := el.Value.(*entry[K])
+		over := (l.opts.MaxEntries > 0 && l.order.Len() > l.opts.MaxEntries) ||
+			(l.opts.MaxBytes > 0 && l.stats.Bytes > l.opts.MaxBytes) ||
+			(l.opts.TTL > 0 && time.Since(e.lastUsed) > l.opts.TTL)
+		if !over {
+			return
+		}
+		l.evict(el, true)
+	}
+}
+
+// evict removes an element and closes its cache if no runtime holds it. Callers hold mu.
+func (l *lru[K]) evict(el *list.Element, counted bool) {
+	e := el.Value.(*entry[K])
+	l.order.Remove(el)
+	delete(l.entries, e.key)
+	l.stats.Entries--
+	l.stats.Bytes -= e.size
+	if counted {
+		l.stats.Evictions++
+	}
+
+	e.evicted = true
+	if e.refs == 0 {
+		e.close()
+	}
+}
+
+// close closes the entry's cache and releases what backs it.
+func (e *entry[K]) close() {
+	e.cache.Close(context.Background())
+	if e.done != nil {
+		e.done()
+	}
 }
@@ -0,0 +1,199 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ignis-runtime/wazero"
+)
+
+// fakeCache is a compilation cache counting how often it is closed.
+type fakeCache struct {
+	closed int
+}
+
+func (c *fakeCache) Close(context.Context) error {
+	c.closed++
+	return nil
+}
+
+// newFakeModCache returns a ModCache creating fake caches, which are recorded
+// in the returned map by key.
+func newFakeModCache(opts Options) (ModCache[string], map[string]*fakeCache) {
+	caches := make(map[string]*fakeCache)
+	mc := NewModCache[string](opts)
+	mc.newCache = func(key string) (wazero.CompilationCache, func(), error) {
+		c := new(fakeCache)
+		caches[key] = c
+		return c, nil, nil
+	}
+	return mc, caches
+}
+
+// keys returns the keys of mc from the most to the least recently used.
+func keys(mc *ModCache[string]) []string {
+	mc.m.mu.Lock()
+	defer mc.m.mu.Unlock()
+	var keys []string
+	for el := mc.m.order.Front(); el != nil; el = el.Next() {
+		keys = append(keys, el.Value.(*entry[string]).key)
+	}
+	return keys
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestModCacheEvictionOrder(t *testing.T) {
+	mc, caches := newFakeModCache(Options{MaxEntries: 2})
+	for _, key := range []string{"a", "b"} {
+		_, release, err := mc.GetOrCreate(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+
+	// Using a makes b the least recently used, so it goes first.
+	if mc.Get("a") == nil {
+		t.Fatal("Get(a) returned no cache")
+	}
+	_, release, err := mc.GetOrCreate("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+
+	if got, want := keys(&mc), []string{"c", "a"}; !equal(got, want) {
+		t.Fatalf("cache holds %q, want %q", got, want)
+	}
+	if caches["b"].closed != 1 || caches["a"].closed != 0 {
+		t.Fatalf("b was closed %d times and a %d times, want once and never", caches["b"].closed, caches["a"].closed)
+	}
+	if s := mc.Stats(); s.Evictions != 1 || s.Entries != 2 || s.Hits != 1 || s.Misses != 3 {
+		t.Fatalf("stats are %+v, want 1 eviction, 2 entries, 1 hit and 3 misses", s)
+	}
+}
+
+func TestModCacheDeferredClose(t *testing.T) {
+	mc, caches := newFakeModCache(Options{})
+	_, release1, err := mc.GetOrCreate("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, release2, err := mc.GetOrCreate("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mc.Remove("a")
+	if mc.Has("a") {
+		t.Fatal("removed key is still cached")
+	}
+	release1()
+	release1() // Releasing twice counts once
+	if caches["a"].closed != 0 {
+		t.Fatal("removed cache was closed while a runtime still holds it")
+	}
+	release2()
+	if caches["a"].closed != 1 {
+		t.Fatalf("removed cache was closed %d times once released, want once", caches["a"].closed)
+	}
+
+	// Caches still in use are not closed when they are evicted either.
+	mc, caches = newFakeModCache(Options{MaxEntries: 1})
+	_, release, err := mc.GetOrCreate("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := mc.GetOrCreate("b"); err != nil {
+		t.Fatal(err)
+	}
+	if mc.Has("a") || caches["a"].closed != 0 {
+		t.Fatalf("a is cached %t and closed %d times, want evicted and open", mc.Has("a"), caches["a"].closed)
+	}
+	release()
+	if caches["a"].closed != 1 {
+		t.Fatalf("evicted cache was closed %d times once released, want once", caches["a"].closed)
+	}
+}
+
+func TestModCacheSetSize(t *testing.T) {
+	mc, caches := newFakeModCache(Options{MaxBytes: 100})
+	for _, key := range []string{"a", "b"} {
+		_, release, err := mc.GetOrCreate(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+
+	mc.SetSize("a", 60)
+	mc.SetSize("b", 30)
+	if s := mc.Stats(); s.Bytes != 90 || s.Entries != 2 {
+		t.Fatalf("stats are %+v, want 90 bytes in 2 entries", s)
+	}
+	mc.SetSize("b", 50) // Sizes are replaced, not added
+	if got, want := keys(&mc), []string{"b"}; !equal(got, want) {
+		t.Fatalf("cache holds %q over budget, want %q", got, want)
+	}
+	if s := mc.Stats(); s.Bytes != 50 || caches["a"].closed != 1 {
+		t.Fatalf("cache holds %d bytes and a was closed %d times, want 50 and once", s.Bytes, caches["a"].closed)
+	}
+	mc.SetSize("missing", 1000)
+	if s := mc.Stats(); s.Bytes != 50 {
+		t.Fatalf("SetSize of a missing key changed the size to %d", s.Bytes)
+	}
+}
+
+func TestModCacheMeasuredSize(t *testing.T) {
+	mc, _ := newFakeModCache(Options{})
+	measured := 0
+	mc.measure = func(string) (int64, error) {
+		measured++
+		return 42, nil
+	}
+	if _, _, err := mc.GetOrCreate("a"); err != nil {
+		t.Fatal(err)
+	}
+	mc.SetSize("a", 1)
+	mc.SetSize("a", 1)
+	if s := mc.Stats(); s.Bytes != 42 || measured != 1 {
+		t.Fatalf("cache holds %d bytes measured %d times, want 42 measured once", s.Bytes, measured)
+	}
+}
+
+func TestModCacheSweep(t *testing.T) {
+	mc, caches := newFakeModCache(Options{TTL: time.Minute})
+	for _, key := range []string{"a", "b"} {
+		_, release, err := mc.GetOrCreate(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	mc.m.mu.Lock()
+	mc.m.entries["a"].Value.(*entry[string]).lastUsed = time.Now().Add(-2 * time.Minute)
+	mc.m.mu.Unlock()
+
+	mc.Sweep()
+	if got, want := keys(&mc), []string{"b"}; !equal(got, want) {
+		t.Fatalf("cache holds %q after Sweep, want %q", got, want)
+	}
+	if caches["a"].closed != 1 || caches["b"].closed != 0 {
+		t.Fatalf("a was closed %d times and b %d times, want once and never", caches["a"].closed, caches["b"].closed)
+	}
+	if s := mc.Stats(); s.Evictions != 1 {
+		t.Fatalf("Sweep counted %d evictions, want 1", s.Evictions)
+	}
+}
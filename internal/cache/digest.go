@@ -0,0 +1,23 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Digest is the SHA-256 of a module's bytes, used to key compiled artifacts.
+type Digest [sha256.Size]byte
+
+// Sum returns the Digest of blob.
+func Sum(blob []byte) Digest {
+	return sha256.Sum256(blob)
+}
+
+func (d Digest) String() string {
+	return hex.EncodeToString(d[:])
+}
+
+// MarshalText implements encoding.TextMarshaler so digests read well in JSON.
+func (d Digest) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
@@ -0,0 +1,263 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ignis-runtime/wazero"
+	"golang.org/x/sys/cpu"
+)
+
+// wazeroModule is the module path of the wazero fork compiled into Ignis.
+const wazeroModule = "github.com/ignis-runtime/wazero"
+
+// staleAfter is how long the entries of another fingerprint must go unused
+// before Prune removes them. Nodes running other builds on the same root,
+// as during rolling restarts, keep theirs fresh by pruning.
+const staleAfter = 24 * time.Hour
+
+// DirCache manages on-disk compilation caches under a root directory.
+// Entries are stored below a fingerprint of the wazero build and the host CPU,
+// so artifacts written by a different build or machine are never loaded.
+type DirCache struct {
+	mu       sync.Mutex
+	root     string
+	dir      string         // root joined with the fingerprint
+	maxBytes int64          // 0 means unbounded
+	open     map[string]int // Entries in use by open compilation caches, which Prune keeps
+}
+
+// NewDirCache initializes a DirCache rooted at root.
+func NewDirCache(root string, maxBytes int64) (*DirCache, error) {
+	dir := filepath.Join(root, Fingerprint())
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	if err := touch(dir); err != nil {
+		return nil, fmt.Errorf("failed to touch cache directory: %w", err)
+	}
+	return &DirCache{root: root, dir: dir, maxBytes: maxBytes, open: make(map[string]int)}, nil
+}
+
+// Path returns the directory holding the artifacts for key.
+func (d *DirCache) Path(key string) string {
+	return filepath.Join(d.dir, key)
+}
+
+// CompilationCache returns a wazero cache persisting its artifacts under
+// Path(key), and a func to call once the cache is closed. Prune keeps the
+// entry until then.
+func (d *DirCache) CompilationCache(key string) (wazero.CompilationCache, func(), error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	path := d.Path(key)
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create cache entry: %w", err)
+	}
+
+	// Mark the entry as recently used so Prune keeps it.
+	if err := touch(path); err != nil {
+		return nil, nil, fmt.Errorf("failed to touch cache entry: %w", err)
+	}
+
+	cache, err := wazero.NewCompilationCacheWithDir(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	d.open[key]++
+
+	var once sync.Once
+	done := func() {
+		once.Do(func() {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			if d.open[key]--; d.open[key] <= 0 {
+				delete(d.open, key)
+			}
+		})
+	}
+	return cache, done, nil
+}
+
+// Size returns the number of bytes used by the current fingerprint's entries.
+func (d *DirCache) Size() (int64, error) {
+	entries, err := d.entries()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, e := range entries {
+		total += e.size
+	}
+	return total, nil
+}
+
+// Prune removes the entries of other fingerprints unused for staleAfter and,
+// if the cache is over its byte budget, the least recently used entries no
+// compilation cache is open on until it fits. Anything else under the root is
+// left alone.
+func (d *DirCache) Prune() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Other nodes sharing the root see this fingerprint is still in use.
+	if err := touch(d.dir); err != nil {
+		return fmt.Errorf("failed to touch cache directory: %w", err)
+	}
+
+	others, err := os.ReadDir(d.root)
+	if err != nil {
+		return fmt.Errorf("failed to list cache root: %w", err)
+	}
+	for _, e := range others {
+		if !e.IsDir() || !isFingerprint(e.Name()) || e.Name() == filepath.Base(d.dir) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || time.Since(info.ModTime()) < staleAfter {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(d.root, e.Name())); err != nil {
+			return fmt.Errorf("failed to remove stale cache %q: %w", e.Name(), err)
+		}
+	}
+
+	if d.maxBytes <= 0 {
+		return nil
+	}
+
+	entries, err := d.entries()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, e := range entries {
+		total += e.size
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].modTime.Before(entries[j].modTime)
+	})
+	for _, e := range entries {
+		if total <= d.maxBytes {
+			break
+		}
+		if d.open[e.name] > 0 {
+			continue
+		}
+		if err := os.RemoveAll(e.path); err != nil {
+			return fmt.Errorf("failed to evict cache entry: %w", err)
+		}
+		total -= e.size
+	}
+	return nil
+}
+
+// dirEntry is a cache entry on disk.
+type dirEntry struct {
+	name    string
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// entries lists the cache entries of the current fingerprint.
+func (d *DirCache) entries() ([]dirEntry, error) {
+	list, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cache directory: %w", err)
+	}
+
+	entries := make([]dirEntry, 0, len(list))
+	for _, e := range list {
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		entry := dirEntry{name: e.Name(), path: filepath.Join(d.dir, e.Name()), modTime: info.ModTime()}
+		if entry.size, err = treeSize(entry.path); err != nil {
+			return nil, fmt.Errorf("failed to size cache entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// EntrySize returns the number of bytes of the artifacts compiled for key.
+func (d *DirCache) EntrySize(key string) (int64, error) {
+	size, err := treeSize(d.Path(key))
+	if err != nil {
+		return 0, fmt.Errorf("failed to size cache entry: %w", err)
+	}
+	return size, nil
+}
+
+// treeSize returns the number of bytes of the regular files below path.
+func treeSize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, f fs.DirEntry, err error) error {
+		if err != nil || f.IsDir() {
+			return err
+		}
+		fi, err := f.Info()
+		if err != nil {
+			return err
+		}
+		size += fi.Size()
+		return nil
+	})
+	return size, err
+}
+
+// touch marks path as used now.
+func touch(path string) error {
+	now := time.Now()
+	return os.Chtimes(path, now, now)
+}
+
+// isFingerprint reports whether name could be a directory named by Fingerprint.
+func isFingerprint(name string) bool {
+	b, err := hex.DecodeString(name)
+	return err == nil && len(b) == fingerprintSize
+}
+
+// fingerprintSize is the number of bytes of a Fingerprint.
+const fingerprintSize = 8
+
+// Fingerprint identifies the wazero build and CPU features that compiled
+// artifacts depend on.
+func Fingerprint() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(h, "%+v\n%+v\n", cpu.X86, cpu.ARM64)
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path != wazeroModule {
+				continue
+			}
+			fmt.Fprintf(h, "%s@%s %s\n", dep.Path, dep.Version, dep.Sum)
+			if dep.Replace != nil {
+				fmt.Fprintf(h, "=> %s@%s %s\n", dep.Replace.Path, dep.Replace.Version, dep.Replace.Sum)
+				// A directory replacement has no version, so tie it to this build.
+				for _, s := range info.Settings {
+					if s.Key == "vcs.revision" || s.Key == "vcs.modified" {
+						fmt.Fprintf(h, "%s=%s\n", s.Key, s.Value)
+					}
+				}
+			}
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)[:fingerprintSize])
+}
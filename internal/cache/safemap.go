@@ -7,6 +7,7 @@ type Maper[K comparable, V any] interface {
 	Add(key K, v V)
 	Remove(key K)
 	Has(key K) bool
+	GetOrCreate(key K, create func() (V, error)) (V, error)
 }
 type SafeMap[K comparable, V any] struct {
 	mu sync.RWMutex
@@ -47,3 +48,30 @@ func (s *SafeMap[K, V]) Has(key K) bool {
 	_, ok := s.m[key]
 	return ok
 }
+
+// GetOrCreate returns the value for key, storing the result of create if it is
+// missing. create runs at most once per missing key, under the write lock.
+func (s *SafeMap[K, V]) GetOrCreate(key K, create func() (V, error)) (V, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if value, ok := s.m[key]; ok {
+		return value, nil
+	}
+	value, err := create()
+	if err != nil {
+		return value, err
+	}
+	s.m[key] = value
+	return value, nil
+}
+
+// Range calls f for each entry until f returns false.
+func (s *SafeMap[K, V]) Range(f func(key K, value V) bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for k, v := range s.m {
+		if !f(k, v) {
+			return
+		}
+	}
+}
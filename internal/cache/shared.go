@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// ArtifactStore shares compiled artifacts between Ignis nodes.
+type ArtifactStore interface {
+	// Fetch copies the artifacts stored under key into dir. It returns an
+	// error wrapping fs.ErrNotExist if nothing is stored under key.
+	Fetch(key, dir string) error
+	// Publish stores the artifacts found in dir under key.
+	Publish(key, dir string) error
+}
+
+// SharedCache is a Cacher that seeds its node-local DirCache from an
+// ArtifactStore before compiling and publishes what it compiles back to it,
+// so a node joining the fleet doesn't compile every module again.
+type SharedCache[K comparable] struct {
+	*ModCache[K]
+	dir    *DirCache
+	store  ArtifactStore
+	synced *SafeMap[K, bool] // Keys already fetched or published, while their artifacts are kept
+}
+
+// NewSharedCache initializes a SharedCache compiling into dir and sharing through store
+func NewSharedCache[K comparable](dir *DirCache, store ArtifactStore, opts Options) *SharedCache[K] {
+	local := NewDirModCache[K](dir, opts)
+	return &SharedCache[K]{
+		ModCache: &local,
+		dir:      dir,
+		store:    store,
+		synced:   NewSafeMap[K, bool](),
+	}
+}
+
+// Do fetches shared artifacts for key, runs compile and publishes the result,
+// deduplicating concurrent calls like ModCache.Do. Store failures are logged
+// and never fail the compilation.
+func (s *SharedCache[K]) Do(key K, compile func() error) (bool, error) {
+	return s.ModCache.Do(key, func() error {
+		name := fmt.Sprint(key)
+		// Artifacts pruned from the node since are fetched again.
+		if s.synced.Has(key) && s.local(name) {
+			return compile()
+		}
+
+		path := s.dir.Path(name)
+		fetched := true
+		if err := s.store.Fetch(name, path); err != nil {
+			fetched = false
+			if !errors.Is(err, fs.ErrNotExist) {
+				log.Printf("Failed to fetch shared artifacts for %s: %v\n", name, err)
+			}
+		}
+
+		if err := compile(); err != nil {
+			return err
+		}
+
+		if !fetched {
+			if err := s.store.Publish(name, path); err != nil {
+				log.Printf("Failed to publish shared artifacts for %s: %v\n", name, err)
+				return nil
+			}
+		}
+		s.synced.Add(key, true)
+		return nil
+	})
+}
+
+// local reports whether the node's cache directory holds artifacts for name.
+func (s *SharedCache[K]) local(name string) bool {
+	size, err := s.dir.EntrySize(name)
+	return err == nil && size > 0
+}
+
+// DirStore is an ArtifactStore backed by a directory, such as a network mount
+// shared by every node. Artifacts are stored below the build Fingerprint.
+type DirStore struct {
+	dir string
+}
+
+// NewDirStore initializes a DirStore rooted at root.
+func NewDirStore(root string) (*DirStore, error) {
+	dir := filepath.Join(root, Fingerprint())
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create artifact store: %w", err)
+	}
+	return &DirStore{dir: dir}, nil
+}
+
+// Fetch copies the artifacts stored under key into dir.
+func (s *DirStore) Fetch(key, dir string) error {
+	src := filepath.Join(s.dir, key)
+	if _, err := os.Stat(src); err != nil {
+		return fmt.Errorf("no artifacts for %s: %w", key, err)
+	}
+	return copyTree(src, dir)
+}
+
+// Publish stores the artifacts found in dir under key.
+func (s *DirStore) Publish(key, dir string) error {
+	return copyTree(dir, filepath.Join(s.dir, key))
+}
+
+// copyTree copies the regular files below src into dst, skipping files that
+// already exist there. Files are renamed into place so readers never see
+// partial artifacts.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if _, err := os.Stat(target); err == nil {
+			return nil
+		}
+		return copyFile(path, target)
+	})
+}
+
+// copyFile copies src to dst through a temporary file in dst's directory.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".tmp-"+filepath.Base(dst))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// node is an Ignis node with its own cache directory, sharing through a store.
+type node struct {
+	dir    *DirCache
+	shared *SharedCache[Digest]
+}
+
+func newNode(t *testing.T, store ArtifactStore, maxBytes int64) node {
+	t.Helper()
+	dir, err := NewDirCache(t.TempDir(), maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node{dir: dir, shared: NewSharedCache[Digest](dir, store, Options{})}
+}
+
+// compile runs a compilation of key on n as the runtime does. Like wazero, it
+// loads the artifact from the node's cache directory if it is there, and
+// otherwise compiles it into the directory. It reports whether it compiled.
+func (n node) compile(t *testing.T, key Digest) bool {
+	t.Helper()
+	_, release, err := n.shared.GetOrCreate(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	compiled := false
+	_, err = n.shared.Do(key, func() error {
+		path := filepath.Join(n.dir.Path(key.String()), "artifact")
+		if _, err := os.Stat(path); err == nil {
+			return nil
+		}
+		compiled = true
+		return os.WriteFile(path, []byte("native code"), 0o644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return compiled
+}
+
+func TestSharedCacheLoadsPublishedArtifacts(t *testing.T) {
+	store, err := NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := newNode(t, store, 0), newNode(t, store, 0)
+	key := Sum([]byte("module"))
+
+	if !a.compile(t, key) {
+		t.Fatal("node A found an artifact before any node compiled")
+	}
+	if b.compile(t, key) {
+		t.Fatal("node B compiled instead of loading the artifact node A published")
+	}
+
+	got, err := os.ReadFile(filepath.Join(b.dir.Path(key.String()), "artifact"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "native code" {
+		t.Fatalf("node B loaded %q, want the artifact of node A", got)
+	}
+}
+
+func TestSharedCacheFetchesPrunedArtifacts(t *testing.T) {
+	store, err := NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := newNode(t, store, 0), newNode(t, store, 1)
+	key := Sum([]byte("module"))
+	a.compile(t, key)
+	if b.compile(t, key) {
+		t.Fatal("node B compiled instead of loading the artifact node A published")
+	}
+
+	// Node B's budget is too small to keep the artifact once it is evicted.
+	b.shared.Remove(key)
+	if err := b.dir.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(b.dir.Path(key.String())); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Prune kept the artifact of node B: %v", err)
+	}
+	if b.compile(t, key) {
+		t.Fatal("node B compiled instead of fetching the pruned artifact again")
+	}
+}
+
+func TestDirStoreFetchMissing(t *testing.T) {
+	store, err := NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Fetch("missing", t.TempDir())
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Fetch of a missing key returned %v, want fs.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,42 @@
+package cache
+
+import "sync"
+
+// call is an in-flight or completed Group.Do call.
+type call struct {
+	wg  sync.WaitGroup
+	err error
+}
+
+// Group deduplicates concurrent work for the same key.
+type Group[K comparable] struct {
+	mu    sync.Mutex
+	calls map[K]*call
+}
+
+// Do runs fn unless a call for key is already in flight, in which case it
+// waits for that call and returns its error with shared set to true.
+func (g *Group[K]) Do(key K, fn func() error) (shared bool, err error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[K]*call)
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return true, c.err
+	}
+	c := new(call)
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		c.wg.Done()
+	}()
+	c.err = fn()
+	return false, c.err
+}
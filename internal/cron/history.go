@@ -0,0 +1,203 @@
+package cron
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outcome is how a run ended.
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success" // The deployment answered with a status below 400
+	OutcomeFailure Outcome = "failure" // The deployment failed or answered with an error status
+	OutcomeSkipped Outcome = "skipped" // The previous run was still running
+	OutcomeMissed  Outcome = "missed"  // Ignis was not running when the run was due
+)
+
+// Run is the record of a run of a trigger.
+type Run struct {
+	EventID   string        `json:"event_id,omitempty"`
+	Scheduled time.Time     `json:"scheduled"`
+	Started   time.Time     `json:"started,omitempty"`
+	Duration  time.Duration `json:"duration,omitempty"`
+	Outcome   Outcome       `json:"outcome"`
+	Status    int           `json:"status,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	Missed    int           `json:"missed,omitempty"` // Number of runs missed, for OutcomeMissed
+}
+
+// History records the runs of triggers, keeping the most recent ones of each.
+// With a directory, runs are also appended to a file per trigger, so missed
+// runs are detected across restarts.
+type History struct {
+	dir  string
+	keep int
+
+	mu    sync.Mutex
+	runs  map[string][]Run
+	lines map[string]int // Runs in the file of each trigger
+}
+
+// NewHistory initializes a History keeping keep runs per trigger, stored in
+// dir unless it is empty.
+func NewHistory(dir string, keep int) (*History, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create history directory: %w", err)
+		}
+	}
+	return &History{dir: dir, keep: keep, runs: make(map[string][]Run), lines: make(map[string]int)}, nil
+}
+
+// Runs returns the recorded runs of the trigger id, oldest first.
+func (h *History) Runs(id string) []Run {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	runs, err := h.load(id)
+	if err != nil {
+		return nil
+	}
+	return append([]Run(nil), runs...)
+}
+
+// Last returns the latest scheduled run of the trigger id, whether it ran or
+// not. Runs are recorded once they end, so one that was interrupted by a
+// restart counts as missed.
+func (h *History) Last(id string) (Run, bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	runs, err := h.load(id)
+	if err != nil || len(runs) == 0 {
+		return Run{}, false, err
+	}
+	last := runs[0]
+	for _, run := range runs[1:] {
+		if run.Scheduled.After(last.Scheduled) {
+			last = run
+		}
+	}
+	return last, true, nil
+}
+
+// Record adds run to the history of the trigger id.
+func (h *History) Record(id string, run Run) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	runs, err := h.load(id)
+	if err != nil {
+		return err
+	}
+	runs = append(runs, run)
+	if len(runs) > h.keep {
+		runs = runs[len(runs)-h.keep:]
+	}
+	h.runs[id] = runs
+	if h.dir == "" {
+		return nil
+	}
+
+	// The file is compacted once it holds twice the runs kept.
+	if err := h.append(id, run); err != nil {
+		return err
+	}
+	if h.lines[id] > 2*h.keep {
+		return h.rewrite(id, runs)
+	}
+	return nil
+}
+
+// load returns the runs of id, reading them from its file the first time.
+func (h *History) load(id string) ([]Run, error) {
+	if runs, ok := h.runs[id]; ok || h.dir == "" {
+		return runs, nil
+	}
+
+	f, err := os.Open(h.path(id))
+	if os.IsNotExist(err) {
+		h.runs[id] = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+
+	var runs []Run
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		h.lines[id]++
+		var run Run
+		if err := json.Unmarshal(scanner.Bytes(), &run); err != nil {
+			continue // A line cut short by a crash
+		}
+		runs = append(runs, run)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	if len(runs) > h.keep {
+		runs = runs[len(runs)-h.keep:]
+	}
+	h.runs[id] = runs
+	return runs, nil
+}
+
+// append appends run to the file of id.
+func (h *History) append(id string, run Run) error {
+	b, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(h.path(id), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	h.lines[id]++
+	return nil
+}
+
+// rewrite replaces the file of id with runs.
+func (h *History) rewrite(id string, runs []Run) error {
+	var sb strings.Builder
+	for _, run := range runs {
+		b, err := json.Marshal(run)
+		if err != nil {
+			return err
+		}
+		sb.Write(b)
+		sb.WriteByte('\n')
+	}
+	tmp := h.path(id) + ".tmp"
+	if err := os.WriteFile(tmp, []byte(sb.String()), 0o644); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	if err := os.Rename(tmp, h.path(id)); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	h.lines[id] = len(runs)
+	return nil
+}
+
+// path returns the file of the trigger id.
+func (h *History) path(id string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, id)
+	return filepath.Join(h.dir, name+".jsonl")
+}
@@ -0,0 +1,229 @@
+package cron
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression.
+type Schedule interface {
+	// Next returns the first activation time after t.
+	Next(t time.Time) time.Time
+}
+
+// field describes one field of a cron expression.
+type field struct {
+	name     string
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	minutes = field{name: "minute", min: 0, max: 59}
+	hours   = field{name: "hour", min: 0, max: 23}
+	days    = field{name: "day of month", min: 1, max: 31}
+	months  = field{name: "month", min: 1, max: 12, names: map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	weekdays = field{name: "day of week", min: 0, max: 7, names: map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// descriptors are the predefined schedules of crontab(5).
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a cron expression: five fields as in crontab(5), one of its
+// @yearly, @monthly, @weekly, @daily or @hourly descriptors, or "@every
+// <duration>". Times are computed in loc, or UTC if nil, unless the expression
+// starts with CRON_TZ=<zone>.
+func Parse(expr string, loc *time.Location) (Schedule, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	expr = strings.TrimSpace(expr)
+	if tz, rest, ok := strings.Cut(expr, " "); ok && strings.HasPrefix(tz, "CRON_TZ=") {
+		var err error
+		if loc, err = time.LoadLocation(strings.TrimPrefix(tz, "CRON_TZ=")); err != nil {
+			return nil, fmt.Errorf("invalid time zone: %w", err)
+		}
+		expr = strings.TrimSpace(rest)
+	}
+
+	if d, ok := strings.CutPrefix(expr, "@every "); ok {
+		interval, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval: %w", err)
+		}
+		if interval < time.Second {
+			return nil, fmt.Errorf("interval %s is shorter than a second", interval)
+		}
+		return every(interval), nil
+	}
+	if d, ok := descriptors[expr]; ok {
+		expr = d
+	} else if strings.HasPrefix(expr, "@") {
+		return nil, fmt.Errorf("unknown descriptor %q", expr)
+	}
+
+	parts := strings.Fields(expr)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("expected 5 fields, found %d in %q", len(parts), expr)
+	}
+	s := &spec{loc: loc}
+	var err error
+	for i, f := range []struct {
+		field
+		bits *uint64
+	}{{minutes, &s.minute}, {hours, &s.hour}, {days, &s.dom}, {months, &s.month}, {weekdays, &s.dow}} {
+		if *f.bits, err = f.parse(parts[i]); err != nil {
+			return nil, err
+		}
+	}
+	// Sunday is both 0 and 7.
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	// As in crontab(5), a restricted day of month and day of week match either.
+	s.anyDay = strings.HasPrefix(parts[2], "*") || strings.HasPrefix(parts[4], "*")
+	return s, nil
+}
+
+// parse returns the values of a field as a bit set.
+func (f field) parse(expr string) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(expr, ",") {
+		rng, step, hasStep := strings.Cut(item, "/")
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(a); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(b); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := f.value(rng)
+			if err != nil {
+				return 0, err
+			}
+			lo, hi = v, v
+			if hasStep {
+				hi = f.max
+			}
+		}
+		if lo > hi {
+			return 0, fmt.Errorf("invalid %s range %q", f.name, item)
+		}
+
+		n := uint64(1)
+		if hasStep {
+			var err error
+			if n, err = strconv.ParseUint(step, 10, 8); err != nil || n == 0 {
+				return 0, fmt.Errorf("invalid %s step %q", f.name, item)
+			}
+		}
+		for v := lo; v <= hi; v += uint(n) {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// value parses a single value of a field, by number or name.
+func (f field) value(s string) (uint, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 8)
+	if err != nil || uint(v) < f.min || uint(v) > f.max {
+		return 0, fmt.Errorf("invalid %s %q", f.name, s)
+	}
+	return uint(v), nil
+}
+
+// spec is a schedule of five cron fields, each a bit set of matching values.
+type spec struct {
+	minute, hour, dom, month, dow uint64
+	anyDay                        bool
+	loc                           *time.Location
+}
+
+// maxYears bounds the search for the next activation of impossible dates,
+// such as February 30th.
+const maxYears = 5
+
+func (s *spec) Next(t time.Time) time.Time {
+	t = t.In(s.loc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxYears, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = after(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.loc))
+			continue
+		}
+		if !s.matchDay(t) {
+			t = after(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.loc))
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = after(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.loc))
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			// Skip straight to the next matching minute of this hour, if any.
+			if next := s.minute >> uint(t.Minute()); next != 0 {
+				t = t.Add(time.Duration(bits.TrailingZeros64(next)) * time.Minute)
+			} else {
+				t = after(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.loc))
+			}
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// after returns next, the start of a later hour, day or month than t, unless
+// it falls in a gap left by a daylight saving time change, which time.Date
+// resolves to an earlier time. The next hour after t is returned instead.
+func after(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+	return t.Add(time.Hour - time.Duration(t.Minute())*time.Minute)
+}
+
+// matchDay reports whether the day of t matches the day of month and day of week fields.
+func (s *spec) matchDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.anyDay {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// every is a schedule activating at a fixed interval. Activations are aligned
+// on multiples of it, so they do not depend on when the schedule started.
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Truncate(time.Duration(e)).Add(time.Duration(e))
+}
@@ -0,0 +1,116 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+	utc := func(s string) time.Time {
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		loc  *time.Location
+		from time.Time
+		want time.Time // Zero if the schedule never activates
+	}{
+		// 2026-01-01 is a Thursday.
+		{"day of month", "0 0 13 * *", nil, utc("2026-01-01T00:00:00Z"), utc("2026-01-13T00:00:00Z")},
+		{"day of week", "0 0 * * fri", nil, utc("2026-01-01T00:00:00Z"), utc("2026-01-02T00:00:00Z")},
+		{"day of month or week, by week", "0 0 13 * 5", nil, utc("2026-01-01T00:00:00Z"), utc("2026-01-02T00:00:00Z")},
+		{"day of month or week, by month", "0 0 13 * 5", nil, utc("2026-01-09T00:00:00Z"), utc("2026-01-13T00:00:00Z")},
+		{"stepped day of month and week", "0 0 */2 * 5", nil, utc("2026-01-01T00:00:00Z"), utc("2026-01-09T00:00:00Z")},
+		{"sunday as 0", "0 0 * * 0", nil, utc("2026-01-01T00:00:00Z"), utc("2026-01-04T00:00:00Z")},
+		{"sunday as 7", "0 0 * * 7", nil, utc("2026-01-01T00:00:00Z"), utc("2026-01-04T00:00:00Z")},
+		{"range to sunday", "0 0 * * 6-7", nil, utc("2026-01-03T00:00:00Z"), utc("2026-01-04T00:00:00Z")},
+		{"step", "*/15 * * * *", nil, utc("2026-01-01T00:07:00Z"), utc("2026-01-01T00:15:00Z")},
+		{"step from value", "5/20 * * * *", nil, utc("2026-01-01T00:26:00Z"), utc("2026-01-01T00:45:00Z")},
+		{"step over range", "10-30/10 * * * *", nil, utc("2026-01-01T00:31:00Z"), utc("2026-01-01T01:10:00Z")},
+		{"step over named months", "0 0 1 jan-mar/2 *", nil, utc("2026-01-01T00:00:00Z"), utc("2026-03-01T00:00:00Z")},
+		{"list", "0 9,17 * * *", nil, utc("2026-01-01T09:00:00Z"), utc("2026-01-01T17:00:00Z")},
+		{"seconds are truncated", "* * * * *", nil, utc("2026-01-01T00:00:59Z"), utc("2026-01-01T00:01:00Z")},
+		{"descriptor", "@monthly", nil, utc("2026-01-15T12:00:00Z"), utc("2026-02-01T00:00:00Z")},
+		{"every", "@every 90m", nil, utc("2026-01-01T00:10:00Z"), utc("2026-01-01T01:30:00Z")},
+		{"time zone", "0 9 * * *", newYork, utc("2026-01-01T00:00:00Z"), utc("2026-01-01T14:00:00Z")},
+		{"CRON_TZ", "CRON_TZ=America/New_York 0 9 * * *", nil, utc("2026-01-01T00:00:00Z"), utc("2026-01-01T14:00:00Z")},
+		// Clocks go forward from 2:00 to 3:00 on 2026-03-08 in New York, so
+		// 2:30 does not exist that day.
+		{"skipped by DST", "30 2 * * *", newYork, utc("2026-03-07T08:00:00Z"), utc("2026-03-09T06:30:00Z")},
+		{"after DST starts", "0 3 * * *", newYork, utc("2026-03-08T05:00:00Z"), utc("2026-03-08T07:00:00Z")},
+		// Clocks go back from 2:00 to 1:00 on 2026-11-01 in New York, so 1:30
+		// happens twice that day; it runs the first time only.
+		{"repeated by DST", "30 1 * * *", newYork, utc("2026-11-01T05:30:00Z"), utc("2026-11-02T06:30:00Z")},
+		{"after DST ends", "0 2 * * *", newYork, utc("2026-11-01T05:30:00Z"), utc("2026-11-01T07:00:00Z")},
+		{"leap day", "0 0 29 2 *", nil, utc("2026-03-01T00:00:00Z"), utc("2028-02-29T00:00:00Z")},
+		{"impossible date", "0 0 30 2 *", nil, utc("2026-01-01T00:00:00Z"), time.Time{}},
+		{"impossible date in April", "0 0 31 4 *", nil, utc("2026-01-01T00:00:00Z"), time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.expr, tt.loc)
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", tt.expr, err)
+			}
+			got := s.Next(tt.from)
+			if !got.Equal(tt.want) {
+				t.Fatalf("Next(%s) of %q = %s, want %s", tt.from, tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleMaxYears(t *testing.T) {
+	// February 29th is next a Sunday in 2032, and then in 2060.
+	s, err := Parse("0 0 29 2 */7", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		from, want time.Time
+	}{
+		{time.Date(2028, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2032, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Time{}},
+		{time.Date(2032, 2, 29, 0, 0, 0, 0, time.UTC), time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := s.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("Next(%s) = %s, want %s", tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"mon * * * *",
+		"@fortnightly",
+		"@every 500ms",
+		"@every soon",
+		"CRON_TZ=Nowhere/Zone * * * * *",
+	} {
+		if _, err := Parse(expr, nil); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", expr)
+		}
+	}
+}
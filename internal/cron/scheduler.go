@@ -0,0 +1,298 @@
+package cron
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	types "github.com/ASparkOfFire/ignis/internal/proto"
+	"github.com/ASparkOfFire/ignis/internal/protocol"
+	"github.com/ASparkOfFire/ignis/internal/trigger"
+	"github.com/google/uuid"
+)
+
+// lateness is how late a run may start before it counts as missed, such as
+// after the host was suspended.
+const lateness = time.Minute
+
+// Scheduler runs triggers on their schedule and records their runs.
+type Scheduler struct {
+	history *History
+
+	mu   sync.Mutex
+	jobs map[string]*job
+	wg   sync.WaitGroup
+}
+
+// NewScheduler initializes a Scheduler recording runs in history.
+func NewScheduler(history *History) *Scheduler {
+	return &Scheduler{history: history, jobs: make(map[string]*job)}
+}
+
+// Add schedules t, whose runs are served by h, once the Scheduler starts. id
+// identifies the trigger in the history and must stay the same across restarts.
+func (s *Scheduler) Add(id string, t Trigger, h http.Handler) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	schedule, _ := Parse(t.Schedule, t.Location)
+	if t.Path == "" {
+		t.Path = "/"
+	}
+	if t.ContentType == "" {
+		t.ContentType = "application/json"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[id] = &job{
+		id:       id,
+		trigger:  t,
+		schedule: schedule,
+		handler:  h,
+		history:  s.history,
+		sem:      make(chan struct{}, 1),
+	}
+	return nil
+}
+
+// Start runs the triggers until ctx is done, after handling the runs they
+// missed since their last recorded run.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			j.loop(ctx, &s.wg)
+		}()
+	}
+}
+
+// Wait waits for the triggers and their runs to end once the context passed
+// to Start is done.
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+// Status is the state of a trigger.
+type Status struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Schedule string    `json:"schedule"`
+	Path     string    `json:"path"`
+	Next     time.Time `json:"next"`
+	Running  int       `json:"running"`
+	Runs     []Run     `json:"runs"`
+}
+
+// Status returns the state and recent runs of every trigger, ordered by ID.
+func (s *Scheduler) Status() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Status, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		j.mu.Lock()
+		list = append(list, Status{
+			ID:       j.id,
+			Name:     j.trigger.Name,
+			Schedule: j.trigger.Schedule,
+			Path:     j.trigger.Path,
+			Next:     j.next,
+			Running:  j.running,
+			Runs:     s.history.Runs(j.id),
+		})
+		j.mu.Unlock()
+	}
+	sort.Slice(list, func(i, k int) bool {
+		return list[i].ID < list[k].ID
+	})
+	return list
+}
+
+// job is a trigger added to a Scheduler.
+type job struct {
+	id       string
+	trigger  Trigger
+	schedule Schedule
+	handler  http.Handler
+	history  *History
+	sem      chan struct{} // Held by the running run, unless overlaps are allowed
+
+	mu      sync.Mutex
+	next    time.Time
+	running int
+	queued  bool
+}
+
+// loop runs the trigger on schedule until ctx is done.
+func (j *job) loop(ctx context.Context, wg *sync.WaitGroup) {
+	last := time.Now()
+	if run, ok, err := j.history.Last(j.id); err != nil {
+		log.Printf("Failed to read history of trigger %s: %v\n", j.id, err)
+	} else if ok {
+		last = run.Scheduled
+	}
+
+	for {
+		// Past runs were missed, except the latest one if it is not too late.
+		var missed []time.Time
+		count := 0
+		due := j.schedule.Next(last)
+		for now := time.Now(); !due.IsZero() && due.Before(now); {
+			next := j.schedule.Next(due)
+			if !next.Before(now) && !due.Before(now.Add(-lateness)) {
+				break
+			}
+			count++
+			if missed = append(missed, due); len(missed) > maxCatchUp {
+				missed = missed[1:]
+			}
+			last, due = due, next
+		}
+		if count > 0 {
+			j.catchUp(ctx, missed, count)
+		}
+		if due.IsZero() {
+			log.Printf("Trigger %s has no next run\n", j.id)
+			return
+		}
+
+		j.mu.Lock()
+		j.next = due
+		j.mu.Unlock()
+
+		var jitter time.Duration
+		if j.trigger.Jitter > 0 {
+			jitter = rand.N(j.trigger.Jitter)
+		}
+		timer := time.NewTimer(time.Until(due) + jitter)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		j.fire(ctx, due, wg)
+		last = due
+	}
+}
+
+// catchUp handles count missed runs, of which missed are the latest, as the
+// trigger's policy says. Catch-up runs run one after the other.
+func (j *job) catchUp(ctx context.Context, missed []time.Time, count int) {
+	var run []time.Time
+	switch j.trigger.Missed {
+	case MissedOnce:
+		run = missed[len(missed)-1:]
+	case MissedAll:
+		run = missed
+	}
+
+	// The record is dated as the latest run it covers, or as the first one
+	// caught up with when there were too many to keep.
+	if skipped := count - len(run); skipped > 0 {
+		last := missed[max(len(missed)-len(run)-1, 0)]
+		j.record(Run{Scheduled: last, Outcome: OutcomeMissed, Missed: skipped})
+	}
+	for _, due := range run {
+		select {
+		case j.sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		j.run(ctx, due)
+		<-j.sem
+	}
+}
+
+// fire starts the run due at due, unless the overlap policy says otherwise.
+func (j *job) fire(ctx context.Context, due time.Time, wg *sync.WaitGroup) {
+	switch j.trigger.Overlap {
+	case OverlapAllow:
+	case OverlapQueue:
+		j.mu.Lock()
+		if j.queued {
+			j.mu.Unlock()
+			j.record(Run{Scheduled: due, Outcome: OutcomeSkipped})
+			return
+		}
+		j.queued = true
+		j.mu.Unlock()
+	default:
+		select {
+		case j.sem <- struct{}{}:
+		default:
+			j.record(Run{Scheduled: due, Outcome: OutcomeSkipped})
+			return
+		}
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if j.trigger.Overlap == OverlapQueue {
+			select {
+			case j.sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			j.mu.Lock()
+			j.queued = false
+			j.mu.Unlock()
+		}
+		j.run(ctx, due)
+		if j.trigger.Overlap != OverlapAllow {
+			<-j.sem
+		}
+	}()
+}
+
+// run invokes the deployment for the run due at due and records the outcome.
+func (j *job) run(ctx context.Context, due time.Time) {
+	j.mu.Lock()
+	j.running++
+	j.mu.Unlock()
+	defer func() {
+		j.mu.Lock()
+		j.running--
+		j.mu.Unlock()
+	}()
+
+	event := &types.Event{
+		ID:         uuid.NewString(),
+		Type:       protocol.EventCron,
+		Source:     j.trigger.Name,
+		Time:       due.UnixMilli(),
+		Data:       j.trigger.Data,
+		Attributes: map[string]string{"schedule": j.trigger.Schedule},
+	}
+	run := Run{EventID: event.ID, Scheduled: due, Started: time.Now()}
+
+	res, err := trigger.Invoke(ctx, j.handler, event, j.trigger.Path, j.trigger.ContentType, j.trigger.Data)
+	run.Duration = time.Since(run.Started)
+	switch {
+	case err != nil:
+		run.Outcome, run.Error = OutcomeFailure, err.Error()
+	case res.Failed():
+		run.Outcome, run.Status, run.Error = OutcomeFailure, res.Status, strings.TrimSpace(string(res.Body))
+		log.Printf("Trigger %s failed: event %s: status %d\n", j.id, event.ID, res.Status)
+	default:
+		run.Outcome, run.Status = OutcomeSuccess, res.Status
+	}
+	j.record(run)
+}
+
+// record adds run to the history, logging failures to do so.
+func (j *job) record(run Run) {
+	if err := j.history.Record(j.id, run); err != nil {
+		log.Printf("Failed to record run of trigger %s: %v\n", j.id, err)
+	}
+}
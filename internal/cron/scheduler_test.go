@@ -0,0 +1,116 @@
+package cron
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// times is a Schedule activating at fixed times, in order.
+type times []time.Time
+
+func (s times) Next(t time.Time) time.Time {
+	for _, v := range s {
+		if v.After(t) {
+			return v
+		}
+	}
+	return time.Time{}
+}
+
+// catchUp runs a job whose last recorded run was due n hours before the
+// latest one, which is too late to run on time, so the n hourly runs due since
+// were missed, until it waits for its next run. It returns the runs recorded
+// and when the latest missed run was due.
+func catchUp(t *testing.T, missed Missed, n int) ([]Run, time.Time) {
+	t.Helper()
+	history, err := NewHistory("", maxCatchUp+10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := time.Now().Add(-2 * lateness)
+	schedule := make(times, 0, n+2)
+	for i := n; i >= -1; i-- {
+		schedule = append(schedule, latest.Add(-time.Duration(i)*time.Hour))
+	}
+	if err := history.Record("job", Run{Scheduled: schedule[0], Outcome: OutcomeSuccess}); err != nil {
+		t.Fatal(err)
+	}
+	j := &job{
+		id:       "job",
+		trigger:  Trigger{Name: "job", Path: "/", ContentType: "application/json", Missed: missed},
+		schedule: schedule[1:],
+		handler:  http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}),
+		history:  history,
+		sem:      make(chan struct{}, 1),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		j.loop(ctx, &wg)
+	}()
+	for {
+		j.mu.Lock()
+		next := j.next
+		j.mu.Unlock()
+		if !next.IsZero() {
+			if !next.Equal(schedule[len(schedule)-1]) {
+				t.Fatalf("next run is due at %s, want %s", next, schedule[len(schedule)-1])
+			}
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+	wg.Wait()
+	return history.Runs("job")[1:], latest
+}
+
+func TestSchedulerMissedRuns(t *testing.T) {
+	tests := []struct {
+		name    string
+		missed  Missed
+		n       int
+		success int
+		skipped int // Runs counted by the OutcomeMissed record, if any
+	}{
+		{"skip", MissedSkip, 5, 0, 5},
+		{"once", MissedOnce, 5, 1, 4},
+		{"once, single", MissedOnce, 1, 1, 0},
+		{"all", MissedAll, 5, 5, 0},
+		{"all, beyond maxCatchUp", MissedAll, maxCatchUp + 20, maxCatchUp, 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs, latest := catchUp(t, tt.missed, tt.n)
+			success, skipped := 0, 0
+			var last time.Time
+			for _, run := range runs {
+				switch run.Outcome {
+				case OutcomeSuccess:
+					success++
+					if !run.Scheduled.After(last) {
+						t.Errorf("run due at %s ran after the one due at %s", run.Scheduled, last)
+					}
+					last = run.Scheduled
+				case OutcomeMissed:
+					skipped += run.Missed
+				default:
+					t.Errorf("unexpected run %+v", run)
+				}
+			}
+			if success != tt.success || skipped != tt.skipped {
+				t.Fatalf("%d runs ran and %d were recorded as missed, want %d and %d", success, skipped, tt.success, tt.skipped)
+			}
+			// The latest missed run is run, if any is.
+			if tt.success > 0 && !last.Equal(latest) {
+				t.Fatalf("latest run ran was due at %s, want %s", last, latest)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package cron
+
+import (
+	"fmt"
+	"time"
+)
+
+// Overlap is what happens when a run is due while the previous one is still running.
+type Overlap string
+
+const (
+	OverlapSkip  Overlap = "skip"  // The new run is skipped
+	OverlapQueue Overlap = "queue" // The new run starts once the previous one ends; further ones are skipped
+	OverlapAllow Overlap = "allow" // Both run concurrently
+)
+
+// Missed is what happens to runs that were due while Ignis was not running.
+type Missed string
+
+const (
+	MissedSkip Missed = "skip" // Missed runs are recorded but not run
+	MissedOnce Missed = "once" // The last missed run is run at startup
+	MissedAll  Missed = "all"  // Every missed run is run at startup, up to maxCatchUp
+)
+
+// maxCatchUp bounds the missed runs run at startup.
+const maxCatchUp = 100
+
+// Trigger invokes a deployment on a cron schedule. Each run is a POST request
+// to Path with Data as its body, which carries an event describing the run.
+type Trigger struct {
+	Name        string
+	Schedule    string         // Cron expression, see Parse
+	Location    *time.Location // Time zone of Schedule, UTC if nil
+	Path        string         // Request URI of the runs, "/" if empty
+	Data        []byte         // Payload sent with each run
+	ContentType string         // Media type of Data, application/json if empty
+	Overlap     Overlap        // OverlapSkip if empty
+	Missed      Missed         // MissedSkip if empty
+	Jitter      time.Duration  // Runs are delayed by a random duration up to this
+}
+
+// Validate parses the schedule of t and checks its policies.
+func (t Trigger) Validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("trigger has no name")
+	}
+	if _, err := Parse(t.Schedule, t.Location); err != nil {
+		return fmt.Errorf("trigger %s: invalid schedule: %w", t.Name, err)
+	}
+	switch t.Overlap {
+	case "", OverlapSkip, OverlapQueue, OverlapAllow:
+	default:
+		return fmt.Errorf("trigger %s: unknown overlap policy %q", t.Name, t.Overlap)
+	}
+	switch t.Missed {
+	case "", MissedSkip, MissedOnce, MissedAll:
+	default:
+		return fmt.Errorf("trigger %s: unknown missed run policy %q", t.Name, t.Missed)
+	}
+	if t.Jitter < 0 {
+		return fmt.Errorf("trigger %s: negative jitter", t.Name)
+	}
+	return nil
+}
@@ -0,0 +1,372 @@
+package deployment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ASparkOfFire/ignis/internal/cache"
+	"github.com/ASparkOfFire/ignis/internal/cron"
+	"github.com/ASparkOfFire/ignis/internal/protocol"
+	"github.com/ASparkOfFire/ignis/internal/queue"
+	"github.com/ASparkOfFire/ignis/internal/runtime"
+
+	"github.com/google/uuid"
+)
+
+// Mode is how requests are delivered to a deployment's module.
+type Mode string
+
+const (
+	ModeStdio    Mode = "stdio"     // FDRequest and FDResponse over stdin and stdout
+	ModeWasiHTTP Mode = "wasi-http" // Through the module's wasi-http incoming handler
+)
+
+// probeTimeout bounds the protocol probe run when a module is loaded.
+const probeTimeout = 10 * time.Second
+
+// Spec describes a deployment to register.
+type Spec struct {
+	ID       uuid.UUID
+	Path     string // Module file, or script file for the JS engine
+	Engine   runtime.RuntimeEngine
+	Encoding protocol.Encoding    // Wire format of the protocol messages, protobuf if empty
+	Debug    bool                 // Include error details and guest stderr in error responses
+	Timeout  time.Duration        // Deadline of each invocation, none if zero
+	Wasi     *runtime.WasiConfig  // Optional, EnableHttp serves modules exporting a wasi-http handler natively
+	Cron     []cron.Trigger       // Schedules on which the deployment is invoked
+	Queues   []queue.Subscription // Queues whose messages invoke the deployment
+	Produces []string             // Queues the module may add messages to through Host
+	Host     *runtime.Host        // Optional, backs the host functions the module calls
+
+	// CrossOriginWebSockets passes WebSocket upgrades from pages of other
+	// origins to the module, which then decides which origins it accepts.
+	CrossOriginWebSockets bool
+}
+
+// Module is a loaded version of a deployment's module. It is never modified,
+// so an invocation sees a consistent module even if the file is updated.
+type Module struct {
+	Blob         []byte
+	Digest       cache.Digest
+	Report       *runtime.Report
+	Mode         Mode
+	Protocol     uint32 // Negotiated protocol version
+	Capabilities uint64 // Capabilities advertised by the module
+}
+
+// fileStat identifies a version of a module file without reading it.
+type fileStat struct {
+	size    int64
+	modTime time.Time
+}
+
+// Deployment is a registered deployment. It tracks the content digest of its
+// module so updated files are re-validated and compiled under a new key.
+type Deployment struct {
+	ID       uuid.UUID
+	Path     string
+	Engine   runtime.RuntimeEngine
+	Encoding protocol.Encoding
+	Debug    bool
+	Timeout  time.Duration
+	Wasi     *runtime.WasiConfig
+	Cron     []cron.Trigger
+	Queues   []queue.Subscription
+	Produces []string
+	Host     *runtime.Host
+
+	CrossOriginWebSockets bool
+
+	cache cache.Cacher[cache.Digest] // Used to run the module when negotiating
+
+	reload sync.Mutex // Held while loading, so an updated file is loaded once
+	mu     sync.RWMutex
+	module *Module
+	stat   fileStat // Of the file module was read from
+}
+
+// Registry holds the deployments accepted by the server.
+type Registry struct {
+	m     *cache.SafeMap[uuid.UUID, *Deployment]
+	cache cache.Cacher[cache.Digest]
+}
+
+// NewRegistry initializes an empty Registry compiling modules into cache
+func NewRegistry(cacher cache.Cacher[cache.Digest]) *Registry {
+	return &Registry{m: cache.NewSafeMap[uuid.UUID, *Deployment](), cache: cacher}
+}
+
+// Register inspects the deployment's module and stores it if Ignis can run it.
+func (r *Registry) Register(ctx context.Context, spec Spec) (*Deployment, error) {
+	encoding, err := protocol.ParseEncoding(string(spec.Encoding))
+	if err != nil {
+		return nil, fmt.Errorf("deployment %s: %w", spec.ID, err)
+	}
+	names := make(map[string]bool, len(spec.Cron))
+	for _, t := range spec.Cron {
+		if err := t.Validate(); err != nil {
+			return nil, fmt.Errorf("deployment %s: %w", spec.ID, err)
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("deployment %s: duplicate trigger %s", spec.ID, t.Name)
+		}
+		names[t.Name] = true
+	}
+	for _, s := range spec.Queues {
+		if err := s.Validate(); err != nil {
+			return nil, fmt.Errorf("deployment %s: %w", spec.ID, err)
+		}
+	}
+
+	d := &Deployment{
+		ID:       spec.ID,
+		Path:     spec.Path,
+		Engine:   spec.Engine,
+		Encoding: encoding,
+		Debug:    spec.Debug,
+		Timeout:  spec.Timeout,
+		Wasi:     spec.Wasi,
+		Cron:     spec.Cron,
+		Queues:   spec.Queues,
+		Produces: spec.Produces,
+		Host:     restrictHost(spec.Host, spec.Produces),
+
+		CrossOriginWebSockets: spec.CrossOriginWebSockets,
+
+		cache: r.cache,
+	}
+	if _, err := d.Load(ctx); err != nil {
+		return nil, err
+	}
+
+	r.m.Add(d.ID, d)
+	return d, nil
+}
+
+// restrictHost returns a copy of host whose Enqueue only accepts the queues
+// listed in produces. Enqueue is unavailable to modules producing to none.
+func restrictHost(host *runtime.Host, produces []string) *runtime.Host {
+	if host == nil {
+		return nil
+	}
+	restricted := *host
+	restricted.Enqueue = nil
+	if host.Enqueue != nil && len(produces) > 0 {
+		restricted.Enqueue = func(ctx context.Context, name string, body []byte) error {
+			if !slices.Contains(produces, name) {
+				return fmt.Errorf("deployment may not enqueue to queue %s", name)
+			}
+			return host.Enqueue(ctx, name, body)
+		}
+	}
+	return &restricted
+}
+
+// Get returns the deployment registered under id.
+func (r *Registry) Get(id uuid.UUID) (*Deployment, bool) {
+	d := r.m.Get(id)
+	return d, d != nil
+}
+
+// List returns all registered deployments ordered by ID.
+func (r *Registry) List() []*Deployment {
+	var list []*Deployment
+	r.m.Range(func(_ uuid.UUID, d *Deployment) bool {
+		list = append(list, d)
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID.String() < list[j].ID.String()
+	})
+	return list
+}
+
+// Load returns the deployment's module. The file is read again when its size
+// or modification time changed since the last load, and if its content did,
+// it is inspected and its protocol version negotiated again, and it is
+// rejected if Ignis can no longer run it.
+func (d *Deployment) Load(ctx context.Context) (*Module, error) {
+	info, err := os.Stat(d.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read module: %w", err)
+	}
+	if m := d.current(info); m != nil {
+		return m, nil
+	}
+
+	// Concurrent requests wait for a single load, which is not cancelled
+	// with the request that started it.
+	d.reload.Lock()
+	defer d.reload.Unlock()
+	if info, err = os.Stat(d.Path); err != nil {
+		return nil, fmt.Errorf("failed to read module: %w", err)
+	}
+	if m := d.current(info); m != nil {
+		return m, nil
+	}
+	ctx = context.WithoutCancel(ctx)
+
+	blob, err := os.ReadFile(d.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read module: %w", err)
+	}
+	stat := fileStat{size: info.Size(), modTime: info.ModTime()}
+
+	digest := cache.Sum(blob)
+	if m := d.Module(); m != nil && m.Digest == digest {
+		d.mu.Lock()
+		d.stat = stat
+		d.mu.Unlock()
+		return m, nil
+	}
+
+	m, err := d.inspect(ctx, blob, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.module, d.stat = m, stat
+	return m, nil
+}
+
+// current returns the loaded module if it was read from the file described by info.
+func (d *Deployment) current(info os.FileInfo) *Module {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.module == nil || d.stat.size != info.Size() || !d.stat.modTime.Equal(info.ModTime()) {
+		return nil
+	}
+	return d.module
+}
+
+// inspect checks Ignis can run blob and negotiates how to deliver requests to it.
+func (d *Deployment) inspect(ctx context.Context, blob []byte, digest cache.Digest) (*Module, error) {
+	report, err := runtime.Inspect(ctx, d.Engine, blob, d.Wasi)
+	if err != nil {
+		return nil, fmt.Errorf("deployment %s: %w", d.ID, err)
+	}
+	if err := report.Validate(); err != nil {
+		return nil, fmt.Errorf("deployment %s rejected: %w", d.ID, err)
+	}
+
+	// Modules with a wasi-http handler are served through it when enabled,
+	// even if they also have _start.
+	mode := ModeStdio
+	if d.Wasi != nil && d.Wasi.EnableHttp && report.UsesWasiHTTP && len(report.Handlers) > 0 {
+		mode = ModeWasiHTTP
+	} else if !report.HasStart {
+		return nil, fmt.Errorf("deployment %s rejected: module only exports a wasi-http handler, which is not enabled", d.ID)
+	}
+
+	version, capabilities := protocol.MaxVersion, uint64(0)
+	if mode == ModeStdio {
+		version, capabilities, err = d.negotiate(ctx, blob, report)
+		if err != nil {
+			return nil, fmt.Errorf("deployment %s rejected: %w", d.ID, err)
+		}
+	}
+
+	return &Module{
+		Blob:         blob,
+		Digest:       digest,
+		Report:       report,
+		Mode:         mode,
+		Protocol:     version,
+		Capabilities: capabilities,
+	}, nil
+}
+
+// negotiate runs the module in probe mode to learn the protocol versions and
+// capabilities it supports, and checks it speaks the deployment's encoding.
+// Modules that cannot answer probes are not run, and speak Version1 in protobuf.
+func (d *Deployment) negotiate(ctx context.Context, blob []byte, report *runtime.Report) (uint32, uint64, error) {
+	if !report.AnswersProbe {
+		if d.Encoding != protocol.EncodingProtobuf {
+			return 0, 0, fmt.Errorf("module predates protocol negotiation and does not support %s encoding", d.Encoding)
+		}
+		return protocol.Version1, protocol.CapEncodingProtobuf, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	var out bytes.Buffer
+	rt, err := runtime.New(ctx, runtime.Args{
+		Stdout:       &out,
+		DeploymentID: d.ID,
+		Engine:       d.Engine,
+		Blob:         blob,
+		Cache:        d.cache,
+		Wasi:         d.Wasi,
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to initialize probe: %w", err)
+	}
+
+	var script []byte
+	if d.Engine == runtime.RuntimeEngineJS {
+		script = blob
+	}
+	env := map[string]string{
+		protocol.ProbeEnv:    "1",
+		protocol.EncodingEnv: string(d.Encoding),
+	}
+	if err := rt.Invoke(bytes.NewReader(nil), env, script); err != nil {
+		if ctx.Err() != nil {
+			return 0, 0, fmt.Errorf("protocol probe did not answer within %s", probeTimeout)
+		}
+		return 0, 0, fmt.Errorf("protocol probe failed: %w", err)
+	}
+
+	// The answer's own encoding is one the module speaks, even if it predates
+	// capability flags.
+	answered := protocol.Sniff(out.Bytes())
+	resp, err := protocol.ReadResponse(&out, answered)
+	if err != nil {
+		return 0, 0, fmt.Errorf("protocol probe failed: %w", err)
+	}
+	version, err := protocol.Negotiate(resp.Head.MinVersion, resp.Head.Version)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	capabilities := resp.Head.Capabilities | answered.Capability()
+	if capabilities&d.Encoding.Capability() == 0 {
+		return 0, 0, fmt.Errorf("module does not support %s encoding", d.Encoding)
+	}
+	return version, capabilities, nil
+}
+
+// Module returns the last loaded module.
+func (d *Deployment) Module() *Module {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.module
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d *Deployment) MarshalJSON() ([]byte, error) {
+	m := d.Module()
+	return json.Marshal(struct {
+		ID           uuid.UUID             `json:"id"`
+		Path         string                `json:"path"`
+		Engine       runtime.RuntimeEngine `json:"engine"`
+		Encoding     protocol.Encoding     `json:"encoding"`
+		Debug        bool                  `json:"debug"`
+		Timeout      time.Duration         `json:"timeout"`
+		Mode         Mode                  `json:"mode"`
+		Digest       cache.Digest          `json:"digest"`
+		Report       *runtime.Report       `json:"report"`
+		Protocol     uint32                `json:"protocol"`
+		Capabilities uint64                `json:"capabilities"`
+	}{d.ID, d.Path, d.Engine, d.Encoding, d.Debug, d.Timeout, m.Mode, m.Digest, m.Report, m.Protocol, m.Capabilities})
+}
@@ -0,0 +1,148 @@
+// Package local runs a module once against a request, outside of the server
+// but the way it would.
+package local
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/ASparkOfFire/ignis/internal/cache"
+	"github.com/ASparkOfFire/ignis/internal/deployment"
+	types "github.com/ASparkOfFire/ignis/internal/proto"
+	"github.com/ASparkOfFire/ignis/internal/protocol"
+	"github.com/ASparkOfFire/ignis/internal/runtime"
+)
+
+// Result is the response of a module and what it wrote besides.
+type Result struct {
+	Status   int
+	Header   http.Header
+	Body     []byte
+	Trailer  http.Header
+	Error    *types.Error // Reported by the guest in place of the response, or while streaming it if Aborted
+	Aborted  bool         // Error ended a response the guest had started
+	Stdout   string       // Logged by modules answering through the response channel
+	Stderr   string
+	Protocol uint32
+	Encoding protocol.Encoding
+	Mode     deployment.Mode
+	Compile  time.Duration // Inspecting, negotiating and compiling the module
+	Run      time.Duration
+}
+
+// Run registers spec like the server does and runs its module once with req.
+// If the module failed once it ran, the Result comes with the error to report
+// its output.
+func Run(spec deployment.Spec, req *http.Request) (*Result, error) {
+	local := cache.NewModCache[cache.Digest](cache.Options{MaxEntries: 1})
+	registry := deployment.NewRegistry(&local)
+
+	start := time.Now()
+	d, err := registry.Register(context.Background(), spec)
+	if err != nil {
+		return nil, err
+	}
+	m := d.Module() // Loaded by Register
+
+	inv := protocol.NewInvocation(d.ID, req, d.Timeout)
+	ctx := context.Background()
+	if !inv.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, inv.Deadline)
+		defer cancel()
+	}
+
+	// Modules with a response channel answer through it, and their stdout
+	// is only logs.
+	var stdout, stderr, logs bytes.Buffer
+	args := runtime.Args{
+		Stdout:       &stdout,
+		Stderr:       &stderr,
+		DeploymentID: d.ID,
+		Engine:       d.Engine,
+		Blob:         m.Blob,
+		Cache:        &local,
+		Wasi:         d.Wasi,
+		Host:         d.Host,
+	}
+	if m.Capabilities&protocol.CapResponseChannel != 0 {
+		args.Stdout, args.Response = &logs, &stdout
+	}
+
+	// Modules reading requests with host functions get an empty stdin.
+	var stdin bytes.Buffer
+	if m.Mode == deployment.ModeStdio {
+		if m.Protocol >= protocol.Version2 && m.Capabilities&protocol.CapHostRequest != 0 {
+			head, err := protocol.EncodeRequestHead(req, inv, m.Protocol, d.Encoding)
+			if err != nil {
+				return nil, err
+			}
+			args.Request = &runtime.Request{
+				Head:     head,
+				Body:     req.Body,
+				Trailer:  func() http.Header { return req.Trailer }, // Set once the body is read
+				Encoding: d.Encoding,
+			}
+		} else if err := protocol.WriteRequest(&stdin, req, inv, m.Protocol, d.Encoding); err != nil {
+			return nil, err
+		}
+	}
+	rt, err := runtime.New(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{
+		Protocol: m.Protocol,
+		Encoding: d.Encoding,
+		Mode:     m.Mode,
+		Compile:  time.Since(start),
+	}
+
+	start = time.Now()
+	if m.Mode == deployment.ModeWasiHTTP {
+		rec := httptest.NewRecorder()
+		err = rt.Serve(rec, req.WithContext(ctx), nil)
+		res.Run, res.Stderr = time.Since(start), stderr.String()
+		if err != nil {
+			return res, err
+		}
+		result := rec.Result()
+		res.Status, res.Header, res.Body, res.Trailer = result.StatusCode, result.Header, rec.Body.Bytes(), result.Trailer
+		return res, nil
+	}
+
+	var script []byte
+	if d.Engine == runtime.RuntimeEngineJS {
+		script = m.Blob
+	}
+	env := map[string]string{protocol.EncodingEnv: string(d.Encoding)}
+	err = rt.Invoke(&stdin, env, script)
+	res.Run, res.Stdout, res.Stderr = time.Since(start), logs.String(), stderr.String()
+	if err != nil {
+		return res, err
+	}
+
+	resp, err := protocol.ReadResponse(&stdout, d.Encoding)
+	if err != nil {
+		return res, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	if guestErr, ok := err.(*protocol.GuestError); ok {
+		res.Error, res.Aborted = guestErr.Err, true
+	} else if err != nil {
+		return res, err
+	}
+	if resp.Head.Error != nil {
+		res.Error = resp.Head.Error
+	}
+	res.Status = int(resp.Head.StatusCode)
+	if res.Status == 0 {
+		res.Status = http.StatusOK
+	}
+	res.Header, res.Body, res.Trailer = protocol.ToHeader(resp.Head.Header), body, resp.Trailer
+	return res, nil
+}
@@ -0,0 +1,62 @@
+package local
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ASparkOfFire/ignis/internal/deployment"
+	"github.com/ASparkOfFire/ignis/internal/protocol"
+	"github.com/ASparkOfFire/ignis/internal/runtime"
+	"github.com/google/uuid"
+)
+
+// buildModule builds the command in dir as a wasip1 module and returns its path.
+func buildModule(t *testing.T, dir string) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping module build in short mode")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command unavailable")
+	}
+	out := filepath.Join(t.TempDir(), "module.wasm")
+	cmd := exec.Command(goBin, "build", "-o", out, dir)
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to build %s: %v\n%s", dir, err, b)
+	}
+	return out
+}
+
+func TestRunFailingModule(t *testing.T) {
+	spec := deployment.Spec{
+		ID:     uuid.New(),
+		Path:   buildModule(t, "./testdata/fail"),
+		Engine: runtime.RuntimeEngineWASM,
+	}
+	res, err := Run(spec, httptest.NewRequest("GET", "/", nil))
+
+	var exit *protocol.ExitError
+	if !errors.As(err, &exit) || exit.Code != protocol.ExitPanic {
+		t.Fatalf("Run returned %v, want the module's exit with code %d", err, protocol.ExitPanic)
+	}
+	if res == nil || !strings.Contains(res.Stderr, "failing on purpose") {
+		t.Fatalf("Run returned %+v, want a result with the module's stderr", res)
+	}
+	if res.Protocol != protocol.Version1 || res.Mode != deployment.ModeStdio {
+		t.Fatalf("module was run in %s mode with protocol %d, want stdio and %d", res.Mode, res.Protocol, protocol.Version1)
+	}
+}
+
+func TestRunMissingModule(t *testing.T) {
+	spec := deployment.Spec{ID: uuid.New(), Path: filepath.Join(t.TempDir(), "missing.wasm")}
+	if res, err := Run(spec, httptest.NewRequest("GET", "/", nil)); err == nil || res != nil {
+		t.Fatalf("Run of a missing module returned %+v and %v, want an error only", res, err)
+	}
+}
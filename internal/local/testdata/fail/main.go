@@ -0,0 +1,6 @@
+// Command fail is a module that crashes before answering.
+package main
+
+func main() {
+	panic("failing on purpose")
+}
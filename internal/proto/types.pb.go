@@ -32,6 +32,19 @@ type FDRequest struct {
 	RemoteAddr       string                   `protobuf:"bytes,7,opt,name=RemoteAddr,proto3" json:"RemoteAddr,omitempty"`
 	RequestURI       string                   `protobuf:"bytes,8,opt,name=RequestURI,proto3" json:"RequestURI,omitempty"`
 	Pattern          string                   `protobuf:"bytes,9,opt,name=Pattern,proto3" json:"Pattern,omitempty"`
+	Proto            string                   `protobuf:"bytes,10,opt,name=Proto,proto3" json:"Proto,omitempty"`
+	ProtoMajor       int32                    `protobuf:"varint,11,opt,name=ProtoMajor,proto3" json:"ProtoMajor,omitempty"`
+	ProtoMinor       int32                    `protobuf:"varint,12,opt,name=ProtoMinor,proto3" json:"ProtoMinor,omitempty"`
+	Scheme           string                   `protobuf:"bytes,13,opt,name=Scheme,proto3" json:"Scheme,omitempty"`
+	Version          uint32                   `protobuf:"varint,14,opt,name=Version,proto3" json:"Version,omitempty"`
+	Capabilities     uint64                   `protobuf:"varint,15,opt,name=Capabilities,proto3" json:"Capabilities,omitempty"`
+	DeploymentID     string                   `protobuf:"bytes,16,opt,name=DeploymentID,proto3" json:"DeploymentID,omitempty"`
+	InvocationID     string                   `protobuf:"bytes,17,opt,name=InvocationID,proto3" json:"InvocationID,omitempty"`
+	Deadline         int64                    `protobuf:"varint,18,opt,name=Deadline,proto3" json:"Deadline,omitempty"` // Unix time in milliseconds, 0 without deadline
+	Traceparent      string                   `protobuf:"bytes,19,opt,name=Traceparent,proto3" json:"Traceparent,omitempty"`
+	Tracestate       string                   `protobuf:"bytes,20,opt,name=Tracestate,proto3" json:"Tracestate,omitempty"`
+	TLS              *TLSInfo                 `protobuf:"bytes,21,opt,name=TLS,proto3" json:"TLS,omitempty"`
+	Event            *Event                   `protobuf:"bytes,22,opt,name=Event,proto3" json:"Event,omitempty"` // Set when the request was made by a trigger rather than a client
 	unknownFields    protoimpl.UnknownFields
 	sizeCache        protoimpl.SizeCache
 }
@@ -129,12 +142,107 @@ func (x *FDRequest) GetPattern() string {
 	return ""
 }
 
+func (x *FDRequest) GetProto() string {
+	if x != nil {
+		return x.Proto
+	}
+	return ""
+}
+
+func (x *FDRequest) GetProtoMajor() int32 {
+	if x != nil {
+		return x.ProtoMajor
+	}
+	return 0
+}
+
+func (x *FDRequest) GetProtoMinor() int32 {
+	if x != nil {
+		return x.ProtoMinor
+	}
+	return 0
+}
+
+func (x *FDRequest) GetScheme() string {
+	if x != nil {
+		return x.Scheme
+	}
+	return ""
+}
+
+func (x *FDRequest) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *FDRequest) GetCapabilities() uint64 {
+	if x != nil {
+		return x.Capabilities
+	}
+	return 0
+}
+
+func (x *FDRequest) GetDeploymentID() string {
+	if x != nil {
+		return x.DeploymentID
+	}
+	return ""
+}
+
+func (x *FDRequest) GetInvocationID() string {
+	if x != nil {
+		return x.InvocationID
+	}
+	return ""
+}
+
+func (x *FDRequest) GetDeadline() int64 {
+	if x != nil {
+		return x.Deadline
+	}
+	return 0
+}
+
+func (x *FDRequest) GetTraceparent() string {
+	if x != nil {
+		return x.Traceparent
+	}
+	return ""
+}
+
+func (x *FDRequest) GetTracestate() string {
+	if x != nil {
+		return x.Tracestate
+	}
+	return ""
+}
+
+func (x *FDRequest) GetTLS() *TLSInfo {
+	if x != nil {
+		return x.TLS
+	}
+	return nil
+}
+
+func (x *FDRequest) GetEvent() *Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
 type FDResponse struct {
 	state         protoimpl.MessageState   `protogen:"open.v1"`
 	Body          []byte                   `protobuf:"bytes,1,opt,name=Body,proto3" json:"Body,omitempty"`
 	StatusCode    int32                    `protobuf:"varint,2,opt,name=StatusCode,proto3" json:"StatusCode,omitempty"`
 	Length        int32                    `protobuf:"varint,3,opt,name=Length,proto3" json:"Length,omitempty"`
 	Header        map[string]*HeaderFields `protobuf:"bytes,4,rep,name=Header,proto3" json:"Header,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Version       uint32                   `protobuf:"varint,5,opt,name=Version,proto3" json:"Version,omitempty"`
+	Capabilities  uint64                   `protobuf:"varint,6,opt,name=Capabilities,proto3" json:"Capabilities,omitempty"`
+	Error         *Error                   `protobuf:"bytes,7,opt,name=Error,proto3" json:"Error,omitempty"`
+	MinVersion    uint32                   `protobuf:"varint,8,opt,name=MinVersion,proto3" json:"MinVersion,omitempty"` // Lowest version the guest speaks, set when answering a probe
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -197,6 +305,34 @@ func (x *FDResponse) GetHeader() map[string]*HeaderFields {
 	return nil
 }
 
+func (x *FDResponse) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *FDResponse) GetCapabilities() uint64 {
+	if x != nil {
+		return x.Capabilities
+	}
+	return 0
+}
+
+func (x *FDResponse) GetError() *Error {
+	if x != nil {
+		return x.Error
+	}
+	return nil
+}
+
+func (x *FDResponse) GetMinVersion() uint32 {
+	if x != nil {
+		return x.MinVersion
+	}
+	return 0
+}
+
 type HeaderFields struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Fields        []string               `protobuf:"bytes,1,rep,name=fields,proto3" json:"fields,omitempty"`
@@ -241,6 +377,82 @@ func (x *HeaderFields) GetFields() []string {
 	return nil
 }
 
+type TLSInfo struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	Version            uint32                 `protobuf:"varint,1,opt,name=Version,proto3" json:"Version,omitempty"`
+	CipherSuite        uint32                 `protobuf:"varint,2,opt,name=CipherSuite,proto3" json:"CipherSuite,omitempty"`
+	ServerName         string                 `protobuf:"bytes,3,opt,name=ServerName,proto3" json:"ServerName,omitempty"`
+	NegotiatedProtocol string                 `protobuf:"bytes,4,opt,name=NegotiatedProtocol,proto3" json:"NegotiatedProtocol,omitempty"`
+	PeerCertificates   [][]byte               `protobuf:"bytes,5,rep,name=PeerCertificates,proto3" json:"PeerCertificates,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *TLSInfo) Reset() {
+	*x = TLSInfo{}
+	mi := &file_internal_proto_types_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TLSInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TLSInfo) ProtoMessage() {}
+
+func (x *TLSInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_types_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TLSInfo.ProtoReflect.Descriptor instead.
+func (*TLSInfo) Descriptor() ([]byte, []int) {
+	return file_internal_proto_types_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *TLSInfo) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *TLSInfo) GetCipherSuite() uint32 {
+	if x != nil {
+		return x.CipherSuite
+	}
+	return 0
+}
+
+func (x *TLSInfo) GetServerName() string {
+	if x != nil {
+		return x.ServerName
+	}
+	return ""
+}
+
+func (x *TLSInfo) GetNegotiatedProtocol() string {
+	if x != nil {
+		return x.NegotiatedProtocol
+	}
+	return ""
+}
+
+func (x *TLSInfo) GetPeerCertificates() [][]byte {
+	if x != nil {
+		return x.PeerCertificates
+	}
+	return nil
+}
+
 type StringSlice struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Fields        []string               `protobuf:"bytes,1,rep,name=fields,proto3" json:"fields,omitempty"`
@@ -250,7 +462,7 @@ type StringSlice struct {
 
 func (x *StringSlice) Reset() {
 	*x = StringSlice{}
-	mi := &file_internal_proto_types_proto_msgTypes[3]
+	mi := &file_internal_proto_types_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -262,7 +474,7 @@ func (x *StringSlice) String() string {
 func (*StringSlice) ProtoMessage() {}
 
 func (x *StringSlice) ProtoReflect() protoreflect.Message {
-	mi := &file_internal_proto_types_proto_msgTypes[3]
+	mi := &file_internal_proto_types_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -275,7 +487,7 @@ func (x *StringSlice) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use StringSlice.ProtoReflect.Descriptor instead.
 func (*StringSlice) Descriptor() ([]byte, []int) {
-	return file_internal_proto_types_proto_rawDescGZIP(), []int{3}
+	return file_internal_proto_types_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *StringSlice) GetFields() []string {
@@ -285,11 +497,216 @@ func (x *StringSlice) GetFields() []string {
 	return nil
 }
 
+type Trailers struct {
+	state         protoimpl.MessageState   `protogen:"open.v1"`
+	Header        map[string]*HeaderFields `protobuf:"bytes,1,rep,name=Header,proto3" json:"Header,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Error         *Error                   `protobuf:"bytes,2,opt,name=Error,proto3" json:"Error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Trailers) Reset() {
+	*x = Trailers{}
+	mi := &file_internal_proto_types_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Trailers) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Trailers) ProtoMessage() {}
+
+func (x *Trailers) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_types_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Trailers.ProtoReflect.Descriptor instead.
+func (*Trailers) Descriptor() ([]byte, []int) {
+	return file_internal_proto_types_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Trailers) GetHeader() map[string]*HeaderFields {
+	if x != nil {
+		return x.Header
+	}
+	return nil
+}
+
+func (x *Trailers) GetError() *Error {
+	if x != nil {
+		return x.Error
+	}
+	return nil
+}
+
+type Error struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Code          string                 `protobuf:"bytes,1,opt,name=Code,proto3" json:"Code,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=Message,proto3" json:"Message,omitempty"`
+	Details       map[string]string      `protobuf:"bytes,3,rep,name=Details,proto3" json:"Details,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Retryable     bool                   `protobuf:"varint,4,opt,name=Retryable,proto3" json:"Retryable,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Error) Reset() {
+	*x = Error{}
+	mi := &file_internal_proto_types_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Error) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Error) ProtoMessage() {}
+
+func (x *Error) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_types_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Error.ProtoReflect.Descriptor instead.
+func (*Error) Descriptor() ([]byte, []int) {
+	return file_internal_proto_types_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Error) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Error) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Error) GetDetails() map[string]string {
+	if x != nil {
+		return x.Details
+	}
+	return nil
+}
+
+func (x *Error) GetRetryable() bool {
+	if x != nil {
+		return x.Retryable
+	}
+	return false
+}
+
+// Event describes what triggered a request that no client made.
+type Event struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ID            string                 `protobuf:"bytes,1,opt,name=ID,proto3" json:"ID,omitempty"`
+	Type          string                 `protobuf:"bytes,2,opt,name=Type,proto3" json:"Type,omitempty"`     // Kind of trigger, such as "ignis.cron"
+	Source        string                 `protobuf:"bytes,3,opt,name=Source,proto3" json:"Source,omitempty"` // Name of the trigger
+	Time          int64                  `protobuf:"varint,4,opt,name=Time,proto3" json:"Time,omitempty"`    // Unix time in milliseconds the event was due
+	Data          []byte                 `protobuf:"bytes,5,opt,name=Data,proto3" json:"Data,omitempty"`     // Payload of the trigger, also sent as the request body
+	Attributes    map[string]string      `protobuf:"bytes,6,rep,name=Attributes,proto3" json:"Attributes,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_internal_proto_types_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_types_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_internal_proto_types_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Event) GetID() string {
+	if x != nil {
+		return x.ID
+	}
+	return ""
+}
+
+func (x *Event) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Event) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *Event) GetTime() int64 {
+	if x != nil {
+		return x.Time
+	}
+	return 0
+}
+
+func (x *Event) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *Event) GetAttributes() map[string]string {
+	if x != nil {
+		return x.Attributes
+	}
+	return nil
+}
+
 var File_internal_proto_types_proto protoreflect.FileDescriptor
 
 const file_internal_proto_types_proto_rawDesc = "" +
 	"\n" +
-	"\x1ainternal/proto/types.proto\x12\x05proto\"\x91\x03\n" +
+	"\x1ainternal/proto/types.proto\x12\x05proto\"\xa9\x06\n" +
 	"\tFDRequest\x12\x16\n" +
 	"\x06Method\x18\x01 \x01(\tR\x06Method\x124\n" +
 	"\x06Header\x18\x02 \x03(\v2\x1c.proto.FDRequest.HeaderEntryR\x06Header\x12\x12\n" +
@@ -303,10 +720,30 @@ const file_internal_proto_types_proto_rawDesc = "" +
 	"\n" +
 	"RequestURI\x18\b \x01(\tR\n" +
 	"RequestURI\x12\x18\n" +
-	"\aPattern\x18\t \x01(\tR\aPattern\x1aN\n" +
+	"\aPattern\x18\t \x01(\tR\aPattern\x12\x14\n" +
+	"\x05Proto\x18\n" +
+	" \x01(\tR\x05Proto\x12\x1e\n" +
+	"\n" +
+	"ProtoMajor\x18\v \x01(\x05R\n" +
+	"ProtoMajor\x12\x1e\n" +
+	"\n" +
+	"ProtoMinor\x18\f \x01(\x05R\n" +
+	"ProtoMinor\x12\x16\n" +
+	"\x06Scheme\x18\r \x01(\tR\x06Scheme\x12\x18\n" +
+	"\aVersion\x18\x0e \x01(\rR\aVersion\x12\"\n" +
+	"\fCapabilities\x18\x0f \x01(\x04R\fCapabilities\x12\"\n" +
+	"\fDeploymentID\x18\x10 \x01(\tR\fDeploymentID\x12\"\n" +
+	"\fInvocationID\x18\x11 \x01(\tR\fInvocationID\x12\x1a\n" +
+	"\bDeadline\x18\x12 \x01(\x03R\bDeadline\x12 \n" +
+	"\vTraceparent\x18\x13 \x01(\tR\vTraceparent\x12\x1e\n" +
+	"\n" +
+	"Tracestate\x18\x14 \x01(\tR\n" +
+	"Tracestate\x12 \n" +
+	"\x03TLS\x18\x15 \x01(\v2\x0e.proto.TLSInfoR\x03TLS\x12\"\n" +
+	"\x05Event\x18\x16 \x01(\v2\f.proto.EventR\x05Event\x1aN\n" +
 	"\vHeaderEntry\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12)\n" +
-	"\x05value\x18\x02 \x01(\v2\x13.proto.HeaderFieldsR\x05value:\x028\x01\"\xdf\x01\n" +
+	"\x05value\x18\x02 \x01(\v2\x13.proto.HeaderFieldsR\x05value:\x028\x01\"\xe1\x02\n" +
 	"\n" +
 	"FDResponse\x12\x12\n" +
 	"\x04Body\x18\x01 \x01(\fR\x04Body\x12\x1e\n" +
@@ -314,14 +751,54 @@ const file_internal_proto_types_proto_rawDesc = "" +
 	"StatusCode\x18\x02 \x01(\x05R\n" +
 	"StatusCode\x12\x16\n" +
 	"\x06Length\x18\x03 \x01(\x05R\x06Length\x125\n" +
-	"\x06Header\x18\x04 \x03(\v2\x1d.proto.FDResponse.HeaderEntryR\x06Header\x1aN\n" +
+	"\x06Header\x18\x04 \x03(\v2\x1d.proto.FDResponse.HeaderEntryR\x06Header\x12\x18\n" +
+	"\aVersion\x18\x05 \x01(\rR\aVersion\x12\"\n" +
+	"\fCapabilities\x18\x06 \x01(\x04R\fCapabilities\x12\"\n" +
+	"\x05Error\x18\a \x01(\v2\f.proto.ErrorR\x05Error\x12\x1e\n" +
+	"\n" +
+	"MinVersion\x18\b \x01(\rR\n" +
+	"MinVersion\x1aN\n" +
 	"\vHeaderEntry\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12)\n" +
 	"\x05value\x18\x02 \x01(\v2\x13.proto.HeaderFieldsR\x05value:\x028\x01\"&\n" +
 	"\fHeaderFields\x12\x16\n" +
-	"\x06fields\x18\x01 \x03(\tR\x06fields\"%\n" +
+	"\x06fields\x18\x01 \x03(\tR\x06fields\"\xc1\x01\n" +
+	"\aTLSInfo\x12\x18\n" +
+	"\aVersion\x18\x01 \x01(\rR\aVersion\x12 \n" +
+	"\vCipherSuite\x18\x02 \x01(\rR\vCipherSuite\x12\x1e\n" +
+	"\n" +
+	"ServerName\x18\x03 \x01(\tR\n" +
+	"ServerName\x12.\n" +
+	"\x12NegotiatedProtocol\x18\x04 \x01(\tR\x12NegotiatedProtocol\x12*\n" +
+	"\x10PeerCertificates\x18\x05 \x03(\fR\x10PeerCertificates\"%\n" +
 	"\vStringSlice\x12\x16\n" +
-	"\x06fields\x18\x01 \x03(\tR\x06fieldsB\x1fZ\x1d.com/ASparkOfFire/ignis/protob\x06proto3"
+	"\x06fields\x18\x01 \x03(\tR\x06fields\"\xb3\x01\n" +
+	"\bTrailers\x123\n" +
+	"\x06Header\x18\x01 \x03(\v2\x1b.proto.Trailers.HeaderEntryR\x06Header\x12\"\n" +
+	"\x05Error\x18\x02 \x01(\v2\f.proto.ErrorR\x05Error\x1aN\n" +
+	"\vHeaderEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12)\n" +
+	"\x05value\x18\x02 \x01(\v2\x13.proto.HeaderFieldsR\x05value:\x028\x01\"\xc4\x01\n" +
+	"\x05Error\x12\x12\n" +
+	"\x04Code\x18\x01 \x01(\tR\x04Code\x12\x18\n" +
+	"\aMessage\x18\x02 \x01(\tR\aMessage\x123\n" +
+	"\aDetails\x18\x03 \x03(\v2\x19.proto.Error.DetailsEntryR\aDetails\x12\x1c\n" +
+	"\tRetryable\x18\x04 \x01(\bR\tRetryable\x1a:\n" +
+	"\fDetailsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xe8\x01\n" +
+	"\x05Event\x12\x0e\n" +
+	"\x02ID\x18\x01 \x01(\tR\x02ID\x12\x12\n" +
+	"\x04Type\x18\x02 \x01(\tR\x04Type\x12\x16\n" +
+	"\x06Source\x18\x03 \x01(\tR\x06Source\x12\x12\n" +
+	"\x04Time\x18\x04 \x01(\x03R\x04Time\x12\x12\n" +
+	"\x04Data\x18\x05 \x01(\fR\x04Data\x12<\n" +
+	"\n" +
+	"Attributes\x18\x06 \x03(\v2\x1c.proto.Event.AttributesEntryR\n" +
+	"Attributes\x1a=\n" +
+	"\x0fAttributesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01B\x1fZ\x1d.com/ASparkOfFire/ignis/protob\x06proto3"
 
 var (
 	file_internal_proto_types_proto_rawDescOnce sync.Once
@@ -335,26 +812,41 @@ func file_internal_proto_types_proto_rawDescGZIP() []byte {
 	return file_internal_proto_types_proto_rawDescData
 }
 
-var file_internal_proto_types_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_internal_proto_types_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
 var file_internal_proto_types_proto_goTypes = []any{
 	(*FDRequest)(nil),    // 0: proto.FDRequest
 	(*FDResponse)(nil),   // 1: proto.FDResponse
 	(*HeaderFields)(nil), // 2: proto.HeaderFields
-	(*StringSlice)(nil),  // 3: proto.StringSlice
-	nil,                  // 4: proto.FDRequest.HeaderEntry
-	nil,                  // 5: proto.FDResponse.HeaderEntry
+	(*TLSInfo)(nil),      // 3: proto.TLSInfo
+	(*StringSlice)(nil),  // 4: proto.StringSlice
+	(*Trailers)(nil),     // 5: proto.Trailers
+	(*Error)(nil),        // 6: proto.Error
+	(*Event)(nil),        // 7: proto.Event
+	nil,                  // 8: proto.FDRequest.HeaderEntry
+	nil,                  // 9: proto.FDResponse.HeaderEntry
+	nil,                  // 10: proto.Trailers.HeaderEntry
+	nil,                  // 11: proto.Error.DetailsEntry
+	nil,                  // 12: proto.Event.AttributesEntry
 }
 var file_internal_proto_types_proto_depIdxs = []int32{
-	4, // 0: proto.FDRequest.Header:type_name -> proto.FDRequest.HeaderEntry
-	3, // 1: proto.FDRequest.TransferEncoding:type_name -> proto.StringSlice
-	5, // 2: proto.FDResponse.Header:type_name -> proto.FDResponse.HeaderEntry
-	2, // 3: proto.FDRequest.HeaderEntry.value:type_name -> proto.HeaderFields
-	2, // 4: proto.FDResponse.HeaderEntry.value:type_name -> proto.HeaderFields
-	5, // [5:5] is the sub-list for method output_type
-	5, // [5:5] is the sub-list for method input_type
-	5, // [5:5] is the sub-list for extension type_name
-	5, // [5:5] is the sub-list for extension extendee
-	0, // [0:5] is the sub-list for field type_name
+	8,  // 0: proto.FDRequest.Header:type_name -> proto.FDRequest.HeaderEntry
+	4,  // 1: proto.FDRequest.TransferEncoding:type_name -> proto.StringSlice
+	3,  // 2: proto.FDRequest.TLS:type_name -> proto.TLSInfo
+	7,  // 3: proto.FDRequest.Event:type_name -> proto.Event
+	9,  // 4: proto.FDResponse.Header:type_name -> proto.FDResponse.HeaderEntry
+	6,  // 5: proto.FDResponse.Error:type_name -> proto.Error
+	10, // 6: proto.Trailers.Header:type_name -> proto.Trailers.HeaderEntry
+	6,  // 7: proto.Trailers.Error:type_name -> proto.Error
+	11, // 8: proto.Error.Details:type_name -> proto.Error.DetailsEntry
+	12, // 9: proto.Event.Attributes:type_name -> proto.Event.AttributesEntry
+	2,  // 10: proto.FDRequest.HeaderEntry.value:type_name -> proto.HeaderFields
+	2,  // 11: proto.FDResponse.HeaderEntry.value:type_name -> proto.HeaderFields
+	2,  // 12: proto.Trailers.HeaderEntry.value:type_name -> proto.HeaderFields
+	13, // [13:13] is the sub-list for method output_type
+	13, // [13:13] is the sub-list for method input_type
+	13, // [13:13] is the sub-list for extension type_name
+	13, // [13:13] is the sub-list for extension extendee
+	0,  // [0:13] is the sub-list for field type_name
 }
 
 func init() { file_internal_proto_types_proto_init() }
@@ -368,7 +860,7 @@ func file_internal_proto_types_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_internal_proto_types_proto_rawDesc), len(file_internal_proto_types_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   6,
+			NumMessages:   13,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -0,0 +1,222 @@
+package protocol
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// cborEnc sorts map keys so messages encode the same every time, and cborDec
+// decodes maps keyed by field names.
+var (
+	cborEnc, _ = cbor.EncOptions{Sort: cbor.SortBytewiseLexical}.EncMode()
+	cborDec, _ = cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]any(nil))}.DecMode()
+)
+
+// marshalCBOR encodes m as a CBOR map keyed by the JSON names of its fields.
+// The mapping follows the message descriptors rather than the generated Go
+// types, so guests such as prelude.js can encode messages by hand: fields
+// with their zero value are left out, bytes are byte strings, integers and
+// enums are integers, repeated fields are arrays and map fields are maps
+// keyed by strings. unmarshalCBOR ignores unknown fields.
+func marshalCBOR(m proto.Message) ([]byte, error) {
+	return cborEnc.Marshal(cborMessage(m.ProtoReflect()))
+}
+
+// cborMessage returns the CBOR map of m.
+func cborMessage(m protoreflect.Message) map[string]any {
+	fields := make(map[string]any)
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.IsList():
+			list := make([]any, v.List().Len())
+			for i := range list {
+				list[i] = cborValue(fd, v.List().Get(i))
+			}
+			fields[fd.JSONName()] = list
+		case fd.IsMap():
+			entries := make(map[string]any, v.Map().Len())
+			v.Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+				entries[k.String()] = cborValue(fd.MapValue(), v)
+				return true
+			})
+			fields[fd.JSONName()] = entries
+		default:
+			fields[fd.JSONName()] = cborValue(fd, v)
+		}
+		return true
+	})
+	return fields
+}
+
+// cborValue returns the CBOR value of a single value of fd.
+func cborValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) any {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return cborMessage(v.Message())
+	case protoreflect.EnumKind:
+		return int64(v.Enum())
+	default:
+		return v.Interface()
+	}
+}
+
+// unmarshalCBOR decodes the CBOR map b into m.
+func unmarshalCBOR(b []byte, m proto.Message) error {
+	var v any
+	if err := cborDec.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	proto.Reset(m)
+	return setCBORMessage(m.ProtoReflect(), v)
+}
+
+// setCBORMessage sets the fields of m from the CBOR map v.
+func setCBORMessage(m protoreflect.Message, v any) error {
+	fields, ok := v.(map[string]any)
+	if !ok {
+		return fmt.Errorf("%s is %T, want a map", m.Descriptor().FullName(), v)
+	}
+	descs := m.Descriptor().Fields()
+	for name, x := range fields {
+		fd := descs.ByJSONName(name)
+		if fd == nil || x == nil {
+			continue
+		}
+		if err := setCBORField(m, fd, x); err != nil {
+			return fmt.Errorf("%s: %w", fd.FullName(), err)
+		}
+	}
+	return nil
+}
+
+// setCBORField sets the field fd of m from the CBOR value x.
+func setCBORField(m protoreflect.Message, fd protoreflect.FieldDescriptor, x any) error {
+	switch {
+	case fd.IsList():
+		items, ok := x.([]any)
+		if !ok {
+			return fmt.Errorf("value is %T, want an array", x)
+		}
+		list := m.Mutable(fd).List()
+		for _, item := range items {
+			v, err := cborElement(fd, item, list.NewElement)
+			if err != nil {
+				return err
+			}
+			list.Append(v)
+		}
+	case fd.IsMap():
+		if fd.MapKey().Kind() != protoreflect.StringKind {
+			return fmt.Errorf("unsupported map key %s", fd.MapKey().Kind())
+		}
+		entries, ok := x.(map[string]any)
+		if !ok {
+			return fmt.Errorf("value is %T, want a map", x)
+		}
+		mp := m.Mutable(fd).Map()
+		for k, item := range entries {
+			v, err := cborElement(fd.MapValue(), item, mp.NewValue)
+			if err != nil {
+				return err
+			}
+			mp.Set(protoreflect.ValueOfString(k).MapKey(), v)
+		}
+	case fd.Message() != nil:
+		return setCBORMessage(m.Mutable(fd).Message(), x)
+	default:
+		v, err := cborScalar(fd, x)
+		if err != nil {
+			return err
+		}
+		m.Set(fd, v)
+	}
+	return nil
+}
+
+// cborElement converts the CBOR value x of an element of fd. Messages are
+// decoded into a new element.
+func cborElement(fd protoreflect.FieldDescriptor, x any, newElement func() protoreflect.Value) (protoreflect.Value, error) {
+	if fd.Message() == nil {
+		return cborScalar(fd, x)
+	}
+	v := newElement()
+	return v, setCBORMessage(v.Message(), x)
+}
+
+// cborScalar converts the CBOR value x of a scalar field fd.
+func cborScalar(fd protoreflect.FieldDescriptor, x any) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		if b, ok := x.(bool); ok {
+			return protoreflect.ValueOfBool(b), nil
+		}
+	case protoreflect.StringKind:
+		if s, ok := x.(string); ok {
+			return protoreflect.ValueOfString(s), nil
+		}
+	case protoreflect.BytesKind:
+		if b, ok := x.([]byte); ok {
+			return protoreflect.ValueOfBytes(b), nil
+		}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n, err := cborInt(x, math.MinInt32, math.MaxInt32)
+		return protoreflect.ValueOfInt32(int32(n)), err
+	case protoreflect.EnumKind:
+		n, err := cborInt(x, math.MinInt32, math.MaxInt32)
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(n)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n, err := cborInt(x, math.MinInt64, math.MaxInt64)
+		return protoreflect.ValueOfInt64(n), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		n, err := cborUint(x, math.MaxUint32)
+		return protoreflect.ValueOfUint32(uint32(n)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		n, err := cborUint(x, math.MaxUint64)
+		return protoreflect.ValueOfUint64(n), err
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		if f, ok := x.(float64); ok {
+			if fd.Kind() == protoreflect.FloatKind {
+				return protoreflect.ValueOfFloat32(float32(f)), nil
+			}
+			return protoreflect.ValueOfFloat64(f), nil
+		}
+	}
+	return protoreflect.Value{}, fmt.Errorf("value is %T, not a %s", x, fd.Kind())
+}
+
+// cborInt returns the CBOR integer x if it is within [min, max].
+func cborInt(x any, min, max int64) (int64, error) {
+	var n int64
+	switch v := x.(type) {
+	case int64:
+		n = v
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, fmt.Errorf("integer %d out of range", v)
+		}
+		n = int64(v)
+	default:
+		return 0, fmt.Errorf("value is %T, want an integer", x)
+	}
+	if n < min || n > max {
+		return 0, fmt.Errorf("integer %d out of range", n)
+	}
+	return n, nil
+}
+
+// cborUint returns the CBOR integer x if it is within [0, max].
+func cborUint(x any, max uint64) (uint64, error) {
+	n, ok := x.(uint64)
+	if !ok {
+		return 0, fmt.Errorf("value is %T, want an unsigned integer", x)
+	}
+	if n > max {
+		return 0, fmt.Errorf("integer %d out of range", n)
+	}
+	return n, nil
+}
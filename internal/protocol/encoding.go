@@ -0,0 +1,85 @@
+package protocol
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Encoding is the wire format of FDRequest, FDResponse and Trailers messages.
+// Body chunks are raw bytes whatever the encoding.
+type Encoding string
+
+const (
+	EncodingProtobuf Encoding = "protobuf"
+	EncodingJSON     Encoding = "json" // Canonical protobuf JSON mapping
+	EncodingCBOR     Encoding = "cbor" // CBOR maps keyed by the JSON field names, see marshalCBOR
+)
+
+// EncodingEnv tells the guest which encoding the host uses for an invocation.
+const EncodingEnv = "IGNIS_ENCODING"
+
+// ParseEncoding parses an encoding name. The empty name is protobuf.
+func ParseEncoding(name string) (Encoding, error) {
+	switch e := Encoding(name); e {
+	case "":
+		return EncodingProtobuf, nil
+	case EncodingProtobuf, EncodingJSON, EncodingCBOR:
+		return e, nil
+	default:
+		return "", fmt.Errorf("unknown encoding %q", name)
+	}
+}
+
+// Capability returns the capability flag advertising support for e.
+func (e Encoding) Capability() uint64 {
+	switch e {
+	case EncodingJSON:
+		return CapEncodingJSON
+	case EncodingCBOR:
+		return CapEncodingCBOR
+	default:
+		return CapEncodingProtobuf
+	}
+}
+
+// Marshal encodes m.
+func (e Encoding) Marshal(m proto.Message) ([]byte, error) {
+	switch e {
+	case EncodingJSON:
+		return protojson.Marshal(m)
+	case EncodingCBOR:
+		return marshalCBOR(m)
+	default:
+		return proto.Marshal(m)
+	}
+}
+
+// Unmarshal decodes b into m.
+func (e Encoding) Unmarshal(b []byte, m proto.Message) error {
+	switch e {
+	case EncodingJSON:
+		return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(b, m)
+	case EncodingCBOR:
+		return unmarshalCBOR(b, m)
+	default:
+		return proto.Unmarshal(b, m)
+	}
+}
+
+// Sniff guesses the encoding of a single message from its first byte. JSON
+// objects start with '{' and CBOR maps with a major type 5 byte, neither of
+// which is a valid tag for the fields of our messages.
+func Sniff(b []byte) Encoding {
+	switch {
+	case len(b) == 0:
+		return EncodingProtobuf
+	case b[0] == '{':
+		return EncodingJSON
+	case b[0]>>5 == 5:
+		return EncodingCBOR
+	default:
+		return EncodingProtobuf
+	}
+}
@@ -0,0 +1,124 @@
+package protocol
+
+import (
+	"testing"
+
+	types "github.com/ASparkOfFire/ignis/internal/proto"
+	"github.com/fxamacker/cbor/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestEncodingRoundTrip(t *testing.T) {
+	header := map[string]*types.HeaderFields{
+		"Content-Type": {Fields: []string{"text/plain"}},
+		"Set-Cookie":   {Fields: []string{"a=1", "b=2"}},
+	}
+	e := &types.Error{Code: "failed", Message: "lost", Details: map[string]string{"step": "2"}, Retryable: true}
+	messages := []struct {
+		name string
+		m    proto.Message
+	}{
+		{"FDRequest", &types.FDRequest{
+			Method:           "POST",
+			Header:           header,
+			Body:             []byte{0, 1, 0xff},
+			ContentLength:    -1,
+			TransferEncoding: &types.StringSlice{Fields: []string{"chunked"}},
+			RequestURI:       "/path?q=1",
+			ProtoMajor:       2,
+			Version:          Version2,
+			Capabilities:     Capabilities,
+			Deadline:         1 << 42,
+			TLS:              &types.TLSInfo{Version: 0x0304, PeerCertificates: [][]byte{{1, 2}, {3}}},
+			Event:            &types.Event{ID: "1", Data: []byte("data"), Attributes: map[string]string{"k": "v"}},
+		}},
+		{"FDResponse", &types.FDResponse{
+			Body:         []byte("hello"),
+			StatusCode:   201,
+			Length:       5,
+			Header:       header,
+			Version:      Version2,
+			Capabilities: 1 << 63,
+			MinVersion:   Version1,
+		}},
+		{"FDResponse error", &types.FDResponse{Error: e}},
+		{"Trailers", &types.Trailers{Header: header, Error: e}},
+		{"empty", &types.FDResponse{}},
+	}
+	for _, enc := range []Encoding{EncodingProtobuf, EncodingJSON, EncodingCBOR} {
+		for _, tt := range messages {
+			t.Run(string(enc)+", "+tt.name, func(t *testing.T) {
+				b, err := enc.Marshal(tt.m)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := tt.m.ProtoReflect().New().Interface()
+				if err := enc.Unmarshal(b, got); err != nil {
+					t.Fatal(err)
+				}
+				if !proto.Equal(got, tt.m) {
+					t.Fatalf("decoded %v, want %v", got, tt.m)
+				}
+				if enc != EncodingProtobuf && Sniff(b) != enc {
+					t.Fatalf("Sniff returned %s, want %s", Sniff(b), enc)
+				}
+			})
+		}
+	}
+}
+
+// TestCBORMapping checks the CBOR form of messages is the one guests encode
+// by hand, such as prelude.js.
+func TestCBORMapping(t *testing.T) {
+	guest := map[string]any{
+		"Body":       []byte("hi"),
+		"StatusCode": 200,
+		"Length":     2,
+		"Header":     map[string]any{"X-Test": map[string]any{"fields": []any{"a", "b"}}},
+		"Error":      map[string]any{"Code": "failed", "Details": map[string]any{"k": "v"}},
+		"Unknown":    "ignored",
+	}
+	want := &types.FDResponse{
+		Body:       []byte("hi"),
+		StatusCode: 200,
+		Length:     2,
+		Header:     map[string]*types.HeaderFields{"X-Test": {Fields: []string{"a", "b"}}},
+		Error:      &types.Error{Code: "failed", Details: map[string]string{"k": "v"}},
+	}
+
+	b, err := cbor.Marshal(guest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got types.FDResponse
+	if err := EncodingCBOR.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(&got, want) {
+		t.Fatalf("decoded %v, want %v", &got, want)
+	}
+
+	// Encoding gives the same form back, without the unknown field.
+	b, err = EncodingCBOR.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(guest, "Unknown")
+	want2, _ := cborEnc.Marshal(guest)
+	if string(b) != string(want2) {
+		t.Fatalf("encoded %x, want %x", b, want2)
+	}
+
+	for _, bad := range []map[string]any{
+		{"StatusCode": "200"},
+		{"StatusCode": uint64(1) << 40},
+		{"Version": -1},
+		{"Body": "hi"},
+		{"Header": []any{"X-Test"}},
+	} {
+		b, _ := cbor.Marshal(bad)
+		if err := EncodingCBOR.Unmarshal(b, &got); err == nil {
+			t.Errorf("Unmarshal of %v succeeded, want an error", bad)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package protocol
+
+import (
+	"fmt"
+
+	types "github.com/ASparkOfFire/ignis/internal/proto"
+)
+
+// GuestError is a structured error reported by the guest in place of a
+// response, or in the trailers of a response that failed while streaming.
+type GuestError struct {
+	Err *types.Error
+}
+
+func (e *GuestError) Error() string {
+	if e.Err.Code == "" {
+		return e.Err.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Err.Code, e.Err.Message)
+}
@@ -0,0 +1,26 @@
+package protocol
+
+import (
+	"context"
+
+	types "github.com/ASparkOfFire/ignis/internal/proto"
+)
+
+// Types of the events sent by triggers.
+const (
+	EventCron  = "ignis.cron"  // A cron schedule is due
+	EventQueue = "ignis.queue" // Messages were received from a queue
+)
+
+type eventKey struct{}
+
+// WithEvent returns a copy of ctx carrying e, for a request made by a trigger.
+func WithEvent(ctx context.Context, e *types.Event) context.Context {
+	return context.WithValue(ctx, eventKey{}, e)
+}
+
+// EventFromContext returns the event carried by ctx, or nil.
+func EventFromContext(ctx context.Context) *types.Event {
+	e, _ := ctx.Value(eventKey{}).(*types.Event)
+	return e
+}
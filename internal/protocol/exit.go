@@ -0,0 +1,33 @@
+package protocol
+
+import "fmt"
+
+// Exit codes of guests. A guest exits with ExitOK once it wrote a response,
+// even one reporting an error, so the host always has an answer to read. The
+// other codes tell why there is none.
+const (
+	ExitOK          uint32 = 0
+	ExitWriteFailed uint32 = 1 // The response could not be written, such as when the host stopped reading
+	ExitPanic       uint32 = 2 // The guest crashed outside of a handler; Go exits with 2 on an unrecovered panic
+	ExitUnsupported uint32 = 3 // The host asked for an encoding the guest does not speak
+)
+
+// ExitError reports that a guest exited with a code other than ExitOK.
+type ExitError struct {
+	Code uint32
+}
+
+func (e *ExitError) Error() string {
+	var reason string
+	switch e.Code {
+	case ExitWriteFailed:
+		reason = "failed to write its response"
+	case ExitPanic:
+		reason = "crashed"
+	case ExitUnsupported:
+		reason = "does not support the requested encoding"
+	default:
+		return fmt.Sprintf("module exited with code %d", e.Code)
+	}
+	return fmt.Sprintf("module exited with code %d: %s", e.Code, reason)
+}
@@ -0,0 +1,248 @@
+package protocol
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+
+	types "github.com/ASparkOfFire/ignis/internal/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// Magic starts every framed stream. Streams without it carry a single
+// FDRequest or FDResponse message, as written by older hosts and guests.
+const Magic = "IGNF"
+
+// MaxChunk is the largest body chunk carried by a single data frame.
+const MaxChunk = 32 << 10
+
+// maxFrame bounds the size of a frame a Reader accepts.
+const maxFrame = 16 << 20
+
+// FrameType identifies the content of a frame.
+type FrameType byte
+
+const (
+	FrameHeaders  FrameType = 'H' // An FDRequest or FDResponse without body
+	FrameData     FrameType = 'D' // A chunk of the body
+	FrameTrailers FrameType = 'T' // A Trailers message ending the stream
+	FrameFlush    FrameType = 'F' // Asks for the body received so far to be forwarded
+)
+
+// Writer writes a framed stream. Each frame is its type, a big-endian
+// uint32 payload length and the payload.
+type Writer struct {
+	w       io.Writer
+	enc     Encoding
+	started bool
+}
+
+// NewWriter initializes a Writer on w encoding messages with enc
+func NewWriter(w io.Writer, enc Encoding) *Writer {
+	return &Writer{w: w, enc: enc}
+}
+
+// WriteFrame writes a single frame, preceded by Magic if it is the first.
+func (w *Writer) WriteFrame(t FrameType, payload []byte) error {
+	hdr := make([]byte, 0, len(Magic)+5)
+	if !w.started {
+		hdr = append(hdr, Magic...)
+		w.started = true
+	}
+	hdr = append(hdr, byte(t))
+	hdr = binary.BigEndian.AppendUint32(hdr, uint32(len(payload)))
+
+	if _, err := w.w.Write(hdr); err != nil {
+		return err
+	}
+	_, err := w.w.Write(payload)
+	return err
+}
+
+// WriteMessage writes m as a frame of type t.
+func (w *Writer) WriteMessage(t FrameType, m proto.Message) error {
+	b, err := w.enc.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to encode frame: %w", err)
+	}
+	return w.WriteFrame(t, b)
+}
+
+// Write writes p as data frames of at most MaxChunk bytes.
+func (w *Writer) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), MaxChunk)]
+		if err := w.WriteFrame(FrameData, chunk); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+// WriteTrailers writes the trailers frame ending the stream. A non-nil e
+// reports that the stream failed after its headers were sent.
+func (w *Writer) WriteTrailers(trailer http.Header, e *types.Error) error {
+	return w.WriteMessage(FrameTrailers, &types.Trailers{Header: FromHeader(trailer), Error: e})
+}
+
+// IsFramed reports whether the stream buffered by r starts with Magic.
+func IsFramed(r *bufio.Reader) bool {
+	b, err := r.Peek(len(Magic))
+	return err == nil && string(b) == Magic
+}
+
+// Reader reads a framed stream.
+type Reader struct {
+	r       *bufio.Reader
+	enc     Encoding
+	started bool
+	onFlush func()
+}
+
+// NewReader initializes a Reader on r decoding messages with enc
+func NewReader(r *bufio.Reader, enc Encoding) *Reader {
+	return &Reader{r: r, enc: enc}
+}
+
+// OnFlush sets the func a body reader calls when it reads a flush frame,
+// after everything before it was returned.
+func (r *Reader) OnFlush(f func()) {
+	r.onFlush = f
+}
+
+// ReadFrame reads the next frame.
+func (r *Reader) ReadFrame() (FrameType, []byte, error) {
+	if !r.started {
+		magic := make([]byte, len(Magic))
+		if _, err := io.ReadFull(r.r, magic); err != nil {
+			return 0, nil, err
+		}
+		if string(magic) != Magic {
+			return 0, nil, fmt.Errorf("stream is not framed")
+		}
+		r.started = true
+	}
+
+	hdr := make([]byte, 5)
+	if _, err := io.ReadFull(r.r, hdr); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(hdr[1:])
+	if size > maxFrame {
+		return 0, nil, fmt.Errorf("frame of %d bytes exceeds limit", size)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r.r, payload); err != nil {
+		return 0, nil, fmt.Errorf("truncated frame: %w", err)
+	}
+	return FrameType(hdr[0]), payload, nil
+}
+
+// ReadMessage reads the next frame, which must be of type t, into m.
+func (r *Reader) ReadMessage(t FrameType, m proto.Message) error {
+	ft, payload, err := r.ReadFrame()
+	if err != nil {
+		return err
+	}
+	if ft != t {
+		return fmt.Errorf("expected frame %q, got %q", t, ft)
+	}
+	if err := r.enc.Unmarshal(payload, m); err != nil {
+		return fmt.Errorf("failed to decode frame: %w", err)
+	}
+	return nil
+}
+
+// Body returns a reader over the data frames that follow. When the trailers
+// frame is reached, its fields are added to trailer, if not nil, and the
+// reader returns io.EOF, or a *GuestError if the trailers report one. If
+// length is positive, the reader fails unless the body has length bytes.
+func (r *Reader) Body(trailer http.Header, length int64) io.Reader {
+	return &bodyReader{r: r, trailer: trailer, length: length}
+}
+
+// bodyReader reads the data frames of a stream.
+type bodyReader struct {
+	r       *Reader
+	trailer http.Header
+	length  int64 // Declared length of the body, unknown if not positive
+	read    int64 // Bytes of the body read so far
+	buf     []byte
+	err     error
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	for len(b.buf) == 0 {
+		if b.err != nil {
+			return 0, b.err
+		}
+
+		t, payload, err := b.r.ReadFrame()
+		switch {
+		case err == io.EOF:
+			b.err = io.ErrUnexpectedEOF
+		case err != nil:
+			b.err = err
+		case t == FrameData:
+			b.read += int64(len(payload))
+			if b.length > 0 && b.read > b.length {
+				b.err = fmt.Errorf("body exceeds declared length of %d bytes", b.length)
+				break
+			}
+			b.buf = payload
+		case t == FrameFlush:
+			if b.r.onFlush != nil {
+				b.r.onFlush()
+			}
+		case t == FrameTrailers:
+			var trailers types.Trailers
+			if err := b.r.enc.Unmarshal(payload, &trailers); err != nil {
+				b.err = fmt.Errorf("failed to decode trailers: %w", err)
+				break
+			}
+			if b.trailer != nil {
+				for k, v := range ToHeader(trailers.Header) {
+					b.trailer[k] = v
+				}
+			}
+			switch {
+			case trailers.Error != nil:
+				b.err = &GuestError{Err: trailers.Error}
+			case b.length > 0 && b.read != b.length:
+				b.err = fmt.Errorf("body of %d bytes does not match declared length of %d bytes", b.read, b.length)
+			default:
+				b.err = io.EOF
+			}
+		default:
+			b.err = fmt.Errorf("unexpected frame %q in body", t)
+		}
+	}
+
+	n := copy(p, b.buf)
+	b.buf = b.buf[n:]
+	return n, nil
+}
+
+// FromHeader converts an http.Header to its protobuf form.
+func FromHeader(h http.Header) map[string]*types.HeaderFields {
+	m := make(map[string]*types.HeaderFields, len(h))
+	for k, v := range h {
+		m[k] = &types.HeaderFields{Fields: v}
+	}
+	return m
+}
+
+// ToHeader converts a protobuf header map to an http.Header.
+func ToHeader(m map[string]*types.HeaderFields) http.Header {
+	h := make(http.Header, len(m))
+	for k, v := range m {
+		h[k] = v.GetFields()
+	}
+	return h
+}
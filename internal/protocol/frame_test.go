@@ -0,0 +1,175 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	types "github.com/ASparkOfFire/ignis/internal/proto"
+)
+
+// frame returns the encoding of a frame without Magic.
+func frame(t FrameType, payload string) string {
+	return string(binary.BigEndian.AppendUint32([]byte{byte(t)}, uint32(len(payload)))) + payload
+}
+
+func newReader(s string) *Reader {
+	return NewReader(bufio.NewReader(strings.NewReader(s)), EncodingProtobuf)
+}
+
+func TestReadFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		stream  string
+		payload string // Of the first frame, if it is read
+		err     string // Error reading the first frame, if any
+	}{
+		{"data", Magic + frame(FrameData, "abc"), "abc", ""},
+		{"empty payload", Magic + frame(FrameFlush, ""), "", ""},
+		{"bad magic", "IGNX" + frame(FrameData, "abc"), "", "not framed"},
+		{"empty stream", "", "", "EOF"},
+		{"truncated magic", "IG", "", "unexpected EOF"},
+		{"truncated header", Magic + "D\x00\x00", "", "unexpected EOF"},
+		{"truncated payload", Magic + frame(FrameData, "abc")[:6], "", "truncated frame"},
+		{"oversized frame", Magic + string(binary.BigEndian.AppendUint32([]byte{'D'}, maxFrame+1)), "", "exceeds limit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, payload, err := newReader(tt.stream).ReadFrame()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("ReadFrame returned %v, want an error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(payload) != tt.payload {
+				t.Fatalf("ReadFrame returned %q, want %q", payload, tt.payload)
+			}
+		})
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, EncodingProtobuf)
+	body := bytes.Repeat([]byte("x"), MaxChunk+1)
+	if n, err := w.Write(body); err != nil || n != len(body) {
+		t.Fatalf("Write wrote %d bytes and returned %v, want %d bytes", n, err, len(body))
+	}
+	if err := w.WriteFrame(FrameFlush, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := Magic + frame(FrameData, string(body[:MaxChunk])) + frame(FrameData, "x") + frame(FrameFlush, "")
+	if buf.String() != want {
+		t.Fatalf("Writer wrote %d bytes, want Magic once and frames of at most MaxChunk bytes", buf.Len())
+	}
+}
+
+func TestBody(t *testing.T) {
+	trailers := func(h http.Header, e *types.Error) string {
+		var buf bytes.Buffer
+		NewWriter(&buf, EncodingProtobuf).WriteTrailers(h, e)
+		return buf.String()[len(Magic):]
+	}
+	done := trailers(http.Header{"Grpc-Status": {"0"}}, nil)
+
+	tests := []struct {
+		name    string
+		frames  string
+		length  int64
+		body    string
+		flushes int
+		err     string // Error ending the body, if not io.EOF
+	}{
+		{"chunks", frame(FrameData, "ab") + frame(FrameData, "c") + done, 0, "abc", 0, ""},
+		{"empty", done, 0, "", 0, ""},
+		{"flushes", frame(FrameData, "a") + frame(FrameFlush, "") + frame(FrameData, "b") + frame(FrameFlush, "") + done, 0, "ab", 2, ""},
+		{"declared length", frame(FrameData, "abc") + done, 3, "abc", 0, ""},
+		{"shorter than declared", frame(FrameData, "ab") + done, 3, "ab", 0, "does not match declared length"},
+		{"longer than declared", frame(FrameData, "abcd") + done, 3, "", 0, "exceeds declared length"},
+		{"no trailers", frame(FrameData, "abc"), 0, "abc", 0, "unexpected EOF"},
+		{"message frame", frame(FrameData, "a") + frame(FrameMessage, "\x01hi") + done, 0, "a", 0, "unexpected frame 'M'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newReader(Magic + tt.frames)
+			flushes := 0
+			r.OnFlush(func() { flushes++ })
+			trailer := http.Header{}
+
+			body, err := io.ReadAll(r.Body(trailer, tt.length))
+			if string(body) != tt.body || flushes != tt.flushes {
+				t.Fatalf("body is %q with %d flushes, want %q with %d", body, flushes, tt.body, tt.flushes)
+			}
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("body ended with %v, want an error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if trailer.Get("Grpc-Status") != "0" {
+				t.Fatalf("trailer is %v, want the trailers after the body", trailer)
+			}
+		})
+	}
+}
+
+func TestGuestErrorTrailers(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, EncodingProtobuf)
+	w.Write([]byte("a"))
+	w.WriteTrailers(nil, &types.Error{Code: "failed", Message: "lost"})
+
+	_, err := io.ReadAll(newReader(buf.String()).Body(nil, 0))
+	var guestErr *GuestError
+	if !errors.As(err, &guestErr) || guestErr.Err.GetCode() != "failed" {
+		t.Fatalf("body ended with %v, want a *GuestError", err)
+	}
+}
+
+func TestWebSocketFrames(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, EncodingProtobuf)
+	w.WriteWebSocketMessage(TextMessage, []byte("hello"))
+	w.WriteWebSocketMessage(BinaryMessage, []byte{0, 1})
+	w.WriteWebSocketMessage(TextMessage, nil)
+	w.WriteFrame(FrameFlush, nil)
+	w.WriteWebSocketClose(1000, "bye")
+	w.WriteFrame(FrameClose, nil)
+
+	r := newReader(buf.String())
+	for _, want := range []struct {
+		typ  int
+		data string
+	}{{TextMessage, "hello"}, {BinaryMessage, "\x00\x01"}, {TextMessage, ""}} {
+		typ, data, err := r.ReadWebSocketMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ != want.typ || string(data) != want.data {
+			t.Fatalf("read message %d %q, want %d %q", typ, data, want.typ, want.data)
+		}
+	}
+	if _, _, err := r.ReadWebSocketMessage(); err == nil || !strings.Contains(err.Error(), "unexpected frame 'F'") {
+		t.Fatalf("reading a flush frame returned %v, want an error", err)
+	}
+	for _, want := range []CloseError{{Code: 1000, Text: "bye"}, {Code: CloseNoStatus}} {
+		_, _, err := r.ReadWebSocketMessage()
+		var closeErr *CloseError
+		if !errors.As(err, &closeErr) || *closeErr != want {
+			t.Fatalf("reading a close frame returned %v, want %v", err, &want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	types "github.com/ASparkOfFire/ignis/internal/proto"
+)
+
+// Response is a guest response whose body may still be streaming.
+type Response struct {
+	Head    *types.FDResponse // Status, headers and declared length; Body is unused
+	Body    io.Reader
+	Trailer http.Header // Filled once Body returns io.EOF
+	Stream  *Reader     // The framed stream, carrying messages after a WebSocket upgrade; nil for Version1
+}
+
+// NewFDRequest builds the headers of an FDRequest from r. The body is sent separately.
+func NewFDRequest(r *http.Request) *types.FDRequest {
+	return &types.FDRequest{
+		Method:           r.Method,
+		Header:           FromHeader(r.Header),
+		ContentLength:    r.ContentLength,
+		TransferEncoding: &types.StringSlice{Fields: r.TransferEncoding},
+		Host:             r.Host,
+		RemoteAddr:       r.RemoteAddr,
+		RequestURI:       r.RequestURI,
+		Pattern:          r.Pattern,
+		Proto:            r.Proto,
+		ProtoMajor:       int32(r.ProtoMajor),
+		ProtoMinor:       int32(r.ProtoMinor),
+		Scheme:           scheme(r),
+		TLS:              tlsInfo(r),
+	}
+}
+
+// tlsInfo describes the TLS connection r was received on, if any.
+func tlsInfo(r *http.Request) *types.TLSInfo {
+	if r.TLS == nil {
+		return nil
+	}
+	info := &types.TLSInfo{
+		Version:            uint32(r.TLS.Version),
+		CipherSuite:        uint32(r.TLS.CipherSuite),
+		ServerName:         r.TLS.ServerName,
+		NegotiatedProtocol: r.TLS.NegotiatedProtocol,
+	}
+	for _, cert := range r.TLS.PeerCertificates {
+		info.PeerCertificates = append(info.PeerCertificates, cert.Raw)
+	}
+	return info
+}
+
+// scheme returns the scheme the client used to reach the server.
+func scheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// WriteRequest writes r and the metadata of inv to w using the given protocol
+// version and encoding: streamed as a headers frame, data frames and a
+// trailers frame from Version2 on, which guests opt into when negotiating,
+// or else as a single FDRequest, which every guest decodes.
+func WriteRequest(w io.Writer, r *http.Request, inv Invocation, version uint32, enc Encoding) error {
+	req := newRequestHead(r, inv, version)
+	if version < Version2 {
+		if r.Body != nil {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				return fmt.Errorf("error reading request body: %w", err)
+			}
+			req.Body = body
+		}
+		b, err := enc.Marshal(req)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+
+	fw := NewWriter(w, enc)
+	if err := fw.WriteMessage(FrameHeaders, req); err != nil {
+		return err
+	}
+	if r.Body != nil {
+		if _, err := io.Copy(fw, r.Body); err != nil {
+			return fmt.Errorf("error reading request body: %w", err)
+		}
+	}
+	return fw.WriteTrailers(r.Trailer, nil)
+}
+
+// EncodeRequestHead encodes the FDRequest of r, without its body, for guests
+// that read the request with host functions.
+func EncodeRequestHead(r *http.Request, inv Invocation, version uint32, enc Encoding) ([]byte, error) {
+	return enc.Marshal(newRequestHead(r, inv, version))
+}
+
+// newRequestHead builds the FDRequest of r, without its body, annotated with inv.
+func newRequestHead(r *http.Request, inv Invocation, version uint32) *types.FDRequest {
+	req := NewFDRequest(r)
+	inv.annotate(req)
+	req.Version = version
+	req.Capabilities = Capabilities
+	return req
+}
+
+// ReadResponse reads the head of a guest response encoded with enc from r,
+// leaving the body to be streamed. Unframed responses are decoded as a single
+// FDResponse. Either fails if the body does not have the declared Length.
+func ReadResponse(r io.Reader, enc Encoding) (*Response, error) {
+	br := bufio.NewReaderSize(r, MaxChunk)
+	if _, err := br.Peek(1); err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("no data read from WASM")
+		}
+		return nil, err
+	}
+
+	if !IsFramed(br) {
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return nil, err
+		}
+		var head types.FDResponse
+		if err := enc.Unmarshal(data, &head); err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+		if head.Length != 0 && int(head.Length) != len(head.Body) {
+			return nil, fmt.Errorf("length %d does not match body of %d bytes", head.Length, len(head.Body))
+		}
+		head.Length = int32(len(head.Body))
+		return &Response{Head: &head, Body: bytes.NewReader(head.Body), Trailer: http.Header{}}, nil
+	}
+
+	fr := NewReader(br, enc)
+	var head types.FDResponse
+	if err := fr.ReadMessage(FrameHeaders, &head); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	resp := &Response{Head: &head, Trailer: http.Header{}, Stream: fr}
+	resp.Body = fr.Body(resp.Trailer, int64(head.Length))
+	return resp, nil
+}
@@ -0,0 +1,151 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	types "github.com/ASparkOfFire/ignis/internal/proto"
+	"github.com/google/uuid"
+)
+
+var encodings = []Encoding{EncodingProtobuf, EncodingJSON, EncodingCBOR}
+
+func TestWriteRequest(t *testing.T) {
+	for _, version := range []uint32{Version1, Version2} {
+		for _, enc := range encodings {
+			t.Run(fmt.Sprintf("version %d, %s", version, enc), func(t *testing.T) {
+				r := httptest.NewRequest(http.MethodPost, "/path?q=1", strings.NewReader("hello"))
+				r.Header["X-Test"] = []string{"a", "b"}
+				r.Trailer = http.Header{"X-Sum": {"1"}}
+				inv := NewInvocation(uuid.New(), r, 0)
+
+				var buf bytes.Buffer
+				if err := WriteRequest(&buf, r, inv, version, enc); err != nil {
+					t.Fatal(err)
+				}
+
+				var req types.FDRequest
+				var body []byte
+				trailer := http.Header{}
+				br := bufio.NewReader(&buf)
+				if framed := IsFramed(br); framed != (version >= Version2) {
+					t.Fatalf("version %d request is framed %t", version, framed)
+				}
+				if version < Version2 {
+					data, _ := io.ReadAll(br)
+					if err := enc.Unmarshal(data, &req); err != nil {
+						t.Fatal(err)
+					}
+					body = req.Body
+				} else {
+					fr := NewReader(br, enc)
+					if err := fr.ReadMessage(FrameHeaders, &req); err != nil {
+						t.Fatal(err)
+					}
+					var err error
+					if body, err = io.ReadAll(fr.Body(trailer, 0)); err != nil {
+						t.Fatal(err)
+					}
+					if trailer.Get("X-Sum") != "1" {
+						t.Errorf("trailer is %v, want X-Sum", trailer)
+					}
+				}
+
+				if req.Method != http.MethodPost || req.RequestURI != "/path?q=1" || req.Version != version || req.Capabilities != Capabilities {
+					t.Errorf("request is %s %s, version %d with capabilities %b", req.Method, req.RequestURI, req.Version, req.Capabilities)
+				}
+				if got := ToHeader(req.Header)["X-Test"]; len(got) != 2 || got[0] != "a" || got[1] != "b" {
+					t.Errorf("X-Test is %q, want both values", got)
+				}
+				if string(body) != "hello" {
+					t.Errorf("body is %q, want %q", body, "hello")
+				}
+			})
+		}
+	}
+}
+
+func TestReadResponse(t *testing.T) {
+	head := func() *types.FDResponse {
+		return &types.FDResponse{
+			Version:    Version2,
+			StatusCode: http.StatusCreated,
+			Header:     FromHeader(http.Header{"Content-Type": {"text/plain"}}),
+		}
+	}
+	// single encodes a Version1 response, framed a Version2 response.
+	single := func(enc Encoding, length int32, body string) []byte {
+		m := head()
+		m.Length, m.Body = length, []byte(body)
+		b, _ := enc.Marshal(m)
+		return b
+	}
+	framed := func(enc Encoding, length int32, body string) []byte {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, enc)
+		m := head()
+		m.Length = length
+		w.WriteMessage(FrameHeaders, m)
+		w.Write([]byte(body))
+		w.WriteTrailers(http.Header{"X-Sum": {"1"}}, nil)
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name    string
+		write   func(Encoding, int32, string) []byte
+		length  int32
+		body    string
+		trailer bool
+		err     string // Error reading the head or body, if any
+	}{
+		{"version 1", single, 0, "hello", false, ""},
+		{"version 1, length", single, 5, "hello", false, ""},
+		{"version 1, mismatched length", single, 3, "hello", false, "does not match"},
+		{"version 2", framed, 0, "hello", true, ""},
+		{"version 2, length", framed, 5, "hello", true, ""},
+		{"version 2, mismatched length", framed, 6, "hello", false, "does not match"},
+	}
+	for _, tt := range tests {
+		for _, enc := range encodings {
+			t.Run(tt.name+", "+string(enc), func(t *testing.T) {
+				resp, err := ReadResponse(bytes.NewReader(tt.write(enc, tt.length, tt.body)), enc)
+				var body []byte
+				if err == nil {
+					body, err = io.ReadAll(resp.Body)
+				}
+				if tt.err != "" {
+					if err == nil || !strings.Contains(err.Error(), tt.err) {
+						t.Fatalf("ReadResponse returned %v, want an error containing %q", err, tt.err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if resp.Head.StatusCode != http.StatusCreated || ToHeader(resp.Head.Header).Get("Content-Type") != "text/plain" {
+					t.Errorf("head is %v, want status 201 and its Content-Type", resp.Head)
+				}
+				if string(body) != tt.body {
+					t.Errorf("body is %q, want %q", body, tt.body)
+				}
+				if got := resp.Trailer.Get("X-Sum") == "1"; got != tt.trailer {
+					t.Errorf("trailer is %v, want X-Sum %t", resp.Trailer, tt.trailer)
+				}
+			})
+		}
+	}
+}
+
+func TestReadResponseEmpty(t *testing.T) {
+	if _, err := ReadResponse(strings.NewReader(""), EncodingProtobuf); err == nil {
+		t.Fatal("ReadResponse of an empty stream succeeded")
+	}
+}
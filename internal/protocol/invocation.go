@@ -0,0 +1,89 @@
+package protocol
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	types "github.com/ASparkOfFire/ignis/internal/proto"
+	"github.com/google/uuid"
+)
+
+// Invocation is the metadata of a single run of a deployment.
+type Invocation struct {
+	DeploymentID uuid.UUID
+	ID           uuid.UUID
+	Deadline     time.Time // Zero without deadline
+	Traceparent  string    // W3C trace context of the host's span
+	Tracestate   string
+	Event        *types.Event // What triggered the invocation, nil for client requests
+}
+
+// NewInvocation starts an invocation of a deployment for r. Its deadline is
+// the earliest of r's context deadline and timeout from now, if positive. The
+// trace context continues the one r carries, if valid, or starts a new trace.
+// Requests made by triggers carry their event in their context.
+func NewInvocation(deploymentID uuid.UUID, r *http.Request, timeout time.Duration) Invocation {
+	inv := Invocation{
+		DeploymentID: deploymentID,
+		ID:           uuid.New(),
+		Event:        EventFromContext(r.Context()),
+	}
+
+	if deadline, ok := r.Context().Deadline(); ok {
+		inv.Deadline = deadline
+	}
+	if timeout > 0 {
+		if deadline := time.Now().Add(timeout); inv.Deadline.IsZero() || deadline.Before(inv.Deadline) {
+			inv.Deadline = deadline
+		}
+	}
+
+	traceID, flags, ok := parseTraceparent(r.Header.Get("Traceparent"))
+	if ok {
+		inv.Tracestate = r.Header.Get("Tracestate")
+	} else {
+		traceID, flags = randomHex(16), "00"
+	}
+	inv.Traceparent = "00-" + traceID + "-" + randomHex(8) + "-" + flags
+	return inv
+}
+
+// annotate adds the invocation metadata to req.
+func (inv Invocation) annotate(req *types.FDRequest) {
+	req.DeploymentID = inv.DeploymentID.String()
+	req.InvocationID = inv.ID.String()
+	if !inv.Deadline.IsZero() {
+		req.Deadline = inv.Deadline.UnixMilli()
+	}
+	req.Traceparent = inv.Traceparent
+	req.Tracestate = inv.Tracestate
+	req.Event = inv.Event
+}
+
+// parseTraceparent returns the trace ID and flags of a version 00 traceparent
+// header, as defined by W3C Trace Context.
+func parseTraceparent(h string) (traceID, flags string, ok bool) {
+	parts := strings.Split(h, "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return "", "", false
+	}
+	for _, p := range parts[1:] {
+		if _, err := hex.DecodeString(p); err != nil || strings.ToLower(p) != p {
+			return "", "", false
+		}
+	}
+	if parts[1] == strings.Repeat("0", 32) || parts[2] == strings.Repeat("0", 16) {
+		return "", "", false
+	}
+	return parts[1], parts[3], true
+}
+
+// randomHex returns n random bytes in lowercase hex.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,43 @@
+package protocol
+
+import (
+	"net/http"
+
+	types "github.com/ASparkOfFire/ignis/internal/proto"
+)
+
+// Problem is an RFC 9457 problem details object. Code, Retryable and Details
+// are extension members carrying the guest's structured error, and Stderr is
+// only set for deployments in debug mode.
+type Problem struct {
+	Type      string            `json:"type,omitempty"`
+	Title     string            `json:"title"`
+	Status    int               `json:"status"`
+	Detail    string            `json:"detail,omitempty"`
+	Instance  string            `json:"instance,omitempty"`
+	Code      string            `json:"code,omitempty"`
+	Retryable bool              `json:"retryable,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	Stderr    string            `json:"stderr,omitempty"`
+}
+
+// GuestProblem maps the structured error of a guest response to a Problem.
+// The guest's status is kept if it is an error status.
+func GuestProblem(head *types.FDResponse) Problem {
+	e := head.Error
+	status := int(head.StatusCode)
+	if status < 400 {
+		status = http.StatusInternalServerError
+		if e.Retryable {
+			status = http.StatusServiceUnavailable
+		}
+	}
+	return Problem{
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    e.Message,
+		Code:      e.Code,
+		Retryable: e.Retryable,
+		Details:   e.Details,
+	}
+}
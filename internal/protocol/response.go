@@ -0,0 +1,96 @@
+package protocol
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	types "github.com/ASparkOfFire/ignis/internal/proto"
+)
+
+// hopHeaders are connection-specific headers a guest must not forward (RFC 9110, section 7.6.1).
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// HeaderTokens splits the comma-separated values of a header.
+func HeaderTokens(h http.Header, name string) []string {
+	var tokens []string
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				tokens = append(tokens, t)
+			}
+		}
+	}
+	return tokens
+}
+
+// ValidateResponse checks the head of a guest's response before it is sent.
+func ValidateResponse(head *types.FDResponse) error {
+	if code := head.StatusCode; code != 0 && (code < 100 || code > 999) {
+		return fmt.Errorf("invalid status code %d", code)
+	}
+	return nil
+}
+
+// WriteResponseHeader sends the status and headers of head to w, keeping
+// every value of repeated headers and dropping hop-by-hop headers. The guest's
+// Content-Length is replaced by the body's length, which the protocol checks,
+// and dropped if that is unknown. The body is to be written next, followed by
+// WriteResponseTrailer.
+func WriteResponseHeader(w http.ResponseWriter, head *types.FDResponse) {
+	header := w.Header()
+	for k, v := range head.Header {
+		for _, val := range v.Fields {
+			header.Add(k, val)
+		}
+	}
+
+	// Trailers the guest declared are announced again once hop headers are gone.
+	trailers := HeaderTokens(header, "Trailer")
+	for _, f := range header.Values("Connection") {
+		for _, name := range strings.Split(f, ",") {
+			header.Del(strings.TrimSpace(name))
+		}
+	}
+	for _, h := range hopHeaders {
+		header.Del(h)
+	}
+	if len(trailers) > 0 {
+		header.Set("Trailer", strings.Join(trailers, ", "))
+	}
+
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "application/octet-stream")
+	}
+	header.Del("Content-Length")
+	if head.Length > 0 {
+		header.Set("Content-Length", strconv.Itoa(int(head.Length)))
+	}
+
+	status := int(head.StatusCode)
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+}
+
+// WriteResponseTrailer sends trailer to w once the body was written.
+func WriteResponseTrailer(w http.ResponseWriter, trailer http.Header) {
+	header := w.Header()
+	for k, v := range trailer {
+		for _, val := range v {
+			header.Add(http.TrailerPrefix+k, val)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package protocol
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	types "github.com/ASparkOfFire/ignis/internal/proto"
+)
+
+func TestWriteResponseHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		length int32
+		header map[string][]string
+		want   http.Header // Headers to check, absent if nil
+	}{
+		{"length", 5, nil, http.Header{"Content-Length": {"5"}}},
+		{"matching Content-Length", 5, map[string][]string{"Content-Length": {"5"}}, http.Header{"Content-Length": {"5"}}},
+		{"mismatched Content-Length", 5, map[string][]string{"content-length": {"7"}}, http.Header{"Content-Length": {"5"}}},
+		{"unverifiable Content-Length", 0, map[string][]string{"Content-Length": {"7"}}, http.Header{"Content-Length": nil}},
+		{"repeated header", 0, map[string][]string{"Set-Cookie": {"a=1", "b=2"}}, http.Header{"Set-Cookie": {"a=1", "b=2"}}},
+		{
+			"hop headers",
+			0,
+			map[string][]string{"Connection": {"X-Hop"}, "X-Hop": {"1"}, "Keep-Alive": {"timeout=5"}, "Transfer-Encoding": {"chunked"}},
+			http.Header{"Connection": nil, "X-Hop": nil, "Keep-Alive": nil, "Transfer-Encoding": nil},
+		},
+		{"declared trailers", 0, map[string][]string{"Trailer": {"Grpc-Status", "Grpc-Message"}}, http.Header{"Trailer": {"Grpc-Status, Grpc-Message"}}},
+		{"default Content-Type", 0, nil, http.Header{"Content-Type": {"application/octet-stream"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			head := &types.FDResponse{StatusCode: http.StatusCreated, Length: tt.length, Header: make(map[string]*types.HeaderFields)}
+			for k, v := range tt.header {
+				head.Header[k] = &types.HeaderFields{Fields: v}
+			}
+			rec := httptest.NewRecorder()
+			WriteResponseHeader(rec, head)
+
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("status is %d, want %d", rec.Code, http.StatusCreated)
+			}
+			for k, want := range tt.want {
+				if got := rec.Header().Values(k); !slices.Equal(got, want) {
+					t.Errorf("%s is %q, want %q", k, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	for code, valid := range map[int32]bool{0: true, 200: true, 101: true, 99: false, 1000: false, -1: false} {
+		err := ValidateResponse(&types.FDResponse{StatusCode: code})
+		if valid != (err == nil) {
+			t.Errorf("ValidateResponse of status %d returned %v", code, err)
+		}
+	}
+}
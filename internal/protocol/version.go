@@ -0,0 +1,68 @@
+package protocol
+
+import "fmt"
+
+// Protocol versions spoken between host and guest.
+const (
+	Version1 uint32 = 1 // A single FDRequest and FDResponse message per invocation
+	Version2 uint32 = 2 // Framed headers, body chunks and trailers in both directions
+
+	MinVersion = Version1
+	MaxVersion = Version2
+)
+
+// Capability flags advertised in FDRequest and echoed in FDResponse.
+const (
+	CapTrailers         uint64 = 1 << iota // Trailers frames carry fields
+	CapEncodingProtobuf                    // Messages may be encoded as protobuf
+	CapEncodingJSON                        // Messages may be encoded as JSON
+	CapEncodingCBOR                        // Messages may be encoded as CBOR
+	CapWebSocket                           // Upgrade requests may be accepted and bridged as WebSockets
+	CapFlush                               // Flush frames forward the response body written so far
+	CapResponseChannel                     // Responses are written with the ignis.response_write host function, leaving stdout to logs
+	CapHostRequest                         // Version2 requests may be read with the ignis.request_* host functions instead of stdin
+)
+
+// Capabilities are the capability flags supported by this build.
+const Capabilities = CapTrailers | CapEncodingProtobuf | CapEncodingJSON | CapEncodingCBOR | CapWebSocket | CapFlush | CapResponseChannel | CapHostRequest
+
+// ProbeEnv is set when the host runs a module only to learn which protocol
+// versions it speaks. The guest answers with a single FDResponse carrying its
+// lowest MinVersion, highest Version and its Capabilities, without serving a
+// request. The answer may use any encoding; the host recognizes it with Sniff.
+const ProbeEnv = "IGNIS_PROTOCOL_PROBE"
+
+// ProbeExport is the function exported by modules that answer probes. Older
+// modules would serve a probe as an empty request, so modules without it are
+// never probed, and speak Version1 in protobuf.
+const ProbeExport = "ignis_protocol"
+
+// Negotiate returns the highest version spoken by both the host and a guest
+// speaking versions guestMin to guestMax, and an error if there is none.
+// Guests that predate versioning report 0 for both and speak Version1.
+func Negotiate(guestMin, guestMax uint32) (uint32, error) {
+	if guestMax == 0 {
+		guestMax = Version1
+	}
+	if guestMin == 0 {
+		guestMin = Version1
+	}
+	if guestMin > guestMax {
+		return 0, fmt.Errorf("module reports invalid protocol versions %d to %d", guestMin, guestMax)
+	}
+	if guestMin > MaxVersion || guestMax < MinVersion {
+		return 0, fmt.Errorf("module speaks protocol versions %d to %d, host supports %d to %d", guestMin, guestMax, MinVersion, MaxVersion)
+	}
+	return min(guestMax, MaxVersion), nil
+}
+
+// CheckVersion returns an error unless a response echoes the version it was requested with.
+func CheckVersion(requested, echoed uint32) error {
+	if echoed == 0 {
+		echoed = Version1
+	}
+	if echoed != requested {
+		return fmt.Errorf("module answered with protocol version %d, expected %d", echoed, requested)
+	}
+	return nil
+}
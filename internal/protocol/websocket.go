@@ -0,0 +1,82 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// WebSocket frames follow the headers frame of a response with status 101, in
+// both directions, until either side sends FrameClose.
+const (
+	FrameMessage FrameType = 'M' // A WebSocket message: its type, then its data
+	FrameClose   FrameType = 'C' // A big-endian uint16 close code, then the reason
+)
+
+// WebSocket message types, numbered like RFC 6455 opcodes.
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+)
+
+// MaxMessage is the largest WebSocket message a message frame carries.
+const MaxMessage = maxFrame - 1
+
+// CloseNoStatus is the close code reported when the peer gave none (RFC 6455, section 7.4.1).
+const CloseNoStatus = 1005
+
+// CloseError is returned by ReadWebSocketMessage once the peer closed the WebSocket.
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket closed: %d %s", e.Code, e.Text)
+}
+
+// WriteUpgrade writes the request r asking to be upgraded to a WebSocket, and
+// returns the Writer on which messages to the guest follow.
+func WriteUpgrade(w io.Writer, r *http.Request, inv Invocation, enc Encoding) (*Writer, error) {
+	req := NewFDRequest(r)
+	inv.annotate(req)
+	req.Version = Version2
+	req.Capabilities = Capabilities
+
+	fw := NewWriter(w, enc)
+	if err := fw.WriteMessage(FrameHeaders, req); err != nil {
+		return nil, err
+	}
+	return fw, fw.WriteTrailers(nil, nil)
+}
+
+// WriteWebSocketMessage writes a message of the given type.
+func (w *Writer) WriteWebSocketMessage(messageType int, data []byte) error {
+	return w.WriteFrame(FrameMessage, append([]byte{byte(messageType)}, data...))
+}
+
+// WriteWebSocketClose writes the close frame ending the WebSocket.
+func (w *Writer) WriteWebSocketClose(code int, text string) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	return w.WriteFrame(FrameClose, append(payload, text...))
+}
+
+// ReadWebSocketMessage reads the next message. It returns a *CloseError once
+// the close frame is read.
+func (r *Reader) ReadWebSocketMessage() (int, []byte, error) {
+	t, payload, err := r.ReadFrame()
+	if err != nil {
+		return 0, nil, err
+	}
+	switch {
+	case t == FrameMessage && len(payload) > 0:
+		return int(payload[0]), payload[1:], nil
+	case t == FrameClose && len(payload) >= 2:
+		return 0, nil, &CloseError{Code: int(binary.BigEndian.Uint16(payload)), Text: string(payload[2:])}
+	case t == FrameClose:
+		return 0, nil, &CloseError{Code: CloseNoStatus}
+	default:
+		return 0, nil, fmt.Errorf("unexpected frame %q in websocket", t)
+	}
+}
@@ -0,0 +1,114 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// validName matches queue names, which are also directory names.
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+
+// Broker hosts the declared queues.
+type Broker struct {
+	dir string
+
+	mu     sync.RWMutex
+	queues map[string]*Queue
+}
+
+// NewBroker initializes a Broker persisting queues in a directory each under
+// dir, or in memory only if dir is empty.
+func NewBroker(dir string) *Broker {
+	return &Broker{dir: dir, queues: make(map[string]*Queue)}
+}
+
+// Declare creates the queue name, and its dead-letter queue, loading the
+// messages persisted by a previous run. Declaring an existing queue returns it.
+func (b *Broker) Declare(name string, opts Options) (*Queue, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if q, ok := b.queues[name]; ok {
+		return q, nil
+	}
+
+	opts = opts.withDefaults(name)
+	if !validName.MatchString(name) || !validName.MatchString(opts.DeadLetter) {
+		return nil, fmt.Errorf("invalid queue name %q", name)
+	}
+	// Dead-letter queues keep their messages, so they can't be chained.
+	if dlq, ok := b.queues[opts.DeadLetter]; ok && !dlq.IsDeadLetter() {
+		return nil, fmt.Errorf("queue %s: dead-letter queue %s has a dead-letter queue", name, opts.DeadLetter)
+	}
+	for _, q := range b.queues {
+		if q.opts.DeadLetter == name && opts.DeadLetter != name {
+			return nil, fmt.Errorf("queue %s: dead-letter queue of %s can't have a dead-letter queue", name, q.name)
+		}
+	}
+
+	q, err := b.declare(name, opts)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := b.queues[opts.DeadLetter]; !ok && opts.DeadLetter != name {
+		// The dead-letter queue is its own, so it keeps its messages.
+		dlq, err := b.declare(opts.DeadLetter, opts)
+		if err != nil {
+			return nil, err
+		}
+		b.queues[dlq.name] = dlq
+	}
+	b.queues[name] = q
+	return q, nil
+}
+
+// declare creates a queue without registering it.
+func (b *Broker) declare(name string, opts Options) (*Queue, error) {
+	q := &Queue{name: name, opts: opts, broker: b, signal: make(chan struct{})}
+	if b.dir != "" {
+		q.dir = filepath.Join(b.dir, name)
+		if err := q.load(); err != nil {
+			return nil, fmt.Errorf("queue %s: %w", name, err)
+		}
+	}
+	return q, nil
+}
+
+// Get returns the queue declared as name.
+func (b *Broker) Get(name string) (*Queue, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	q, ok := b.queues[name]
+	return q, ok
+}
+
+// List returns the declared queues ordered by name.
+func (b *Broker) List() []*Queue {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	list := make([]*Queue, 0, len(b.queues))
+	for _, q := range b.queues {
+		list = append(list, q)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].name < list[j].name
+	})
+	return list
+}
+
+// Enqueue adds body to the queue name. It is how guests produce messages, so
+// dead-letter queues are refused.
+func (b *Broker) Enqueue(_ context.Context, name string, body []byte) error {
+	q, ok := b.Get(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if q.IsDeadLetter() {
+		return fmt.Errorf("%w: %s", ErrDeadLetter, name)
+	}
+	_, err := q.Enqueue(body, nil, 0)
+	return err
+}
@@ -0,0 +1,154 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	types "github.com/ASparkOfFire/ignis/internal/proto"
+	"github.com/ASparkOfFire/ignis/internal/protocol"
+	"github.com/ASparkOfFire/ignis/internal/trigger"
+	"github.com/google/uuid"
+)
+
+// FailedHeader lists the IDs of the messages of a batch that failed, in an
+// otherwise successful response. The others are acknowledged.
+const FailedHeader = "Ignis-Failed-Messages"
+
+// Subscription invokes a deployment with the messages of a queue. Each
+// invocation is a POST request to Path. A single message is its body; a batch
+// is a JSON array of messages. Messages are acknowledged if the deployment
+// answers with a status below 400, and retried otherwise.
+type Subscription struct {
+	Queue       string
+	Path        string // Request URI of the invocations, "/" if empty
+	Batch       int    // Messages per invocation, 1 if zero
+	Concurrency int    // Invocations at once, 1 if zero
+}
+
+// Validate checks s.
+func (s Subscription) Validate() error {
+	if s.Queue == "" {
+		return fmt.Errorf("subscription has no queue")
+	}
+	if s.Batch < 0 || s.Concurrency < 0 {
+		return fmt.Errorf("subscription to %s: negative batch size or concurrency", s.Queue)
+	}
+	return nil
+}
+
+// Consume invokes h with the messages of q as s says, until ctx is done.
+func Consume(ctx context.Context, q *Queue, s Subscription, h http.Handler) {
+	if s.Path == "" {
+		s.Path = "/"
+	}
+	s.Batch, s.Concurrency = max(s.Batch, 1), max(s.Concurrency, 1)
+
+	var wg sync.WaitGroup
+	for range s.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				msgs, err := q.Receive(ctx, s.Batch)
+				if err != nil {
+					return // ctx is done
+				}
+				deliver(ctx, q, s, h, msgs)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// batchMessage is a message in the body of a batch.
+type batchMessage struct {
+	ID         string            `json:"id"`
+	Body       []byte            `json:"body"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Enqueued   time.Time         `json:"enqueued"`
+	Attempt    int               `json:"attempt"`
+}
+
+// deliver invokes h with msgs, and acknowledges or fails them depending on
+// its response. The invocation ends when the messages become visible again.
+func deliver(ctx context.Context, q *Queue, s Subscription, h http.Handler, msgs []Message) {
+	event := &types.Event{
+		Type:   protocol.EventQueue,
+		Source: q.Name(),
+	}
+	var contentType string
+	if s.Batch == 1 {
+		m := msgs[0]
+		event.ID, event.Time, event.Data = m.ID, m.Enqueued.UnixMilli(), m.Body
+		event.Attributes = map[string]string{"attempt": strconv.Itoa(m.Attempts)}
+		for k, v := range m.Attributes {
+			event.Attributes[k] = v
+		}
+		contentType = m.Attributes["content-type"]
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+	} else {
+		batch := make([]batchMessage, len(msgs))
+		for i, m := range msgs {
+			batch[i] = batchMessage{ID: m.ID, Body: m.Body, Attributes: m.Attributes, Enqueued: m.Enqueued, Attempt: m.Attempts}
+		}
+		data, err := json.Marshal(batch)
+		if err != nil {
+			failAll(q, msgs, err.Error())
+			return
+		}
+		event.ID, event.Time, event.Data = uuid.NewString(), time.Now().UnixMilli(), data
+		event.Attributes = map[string]string{"batch": strconv.Itoa(len(msgs))}
+		contentType = "application/json"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, q.Options().VisibilityTimeout)
+	defer cancel()
+	res, err := trigger.Invoke(ctx, h, event, s.Path, contentType, event.Data)
+	if ctx.Err() != nil && ctx.Err() != context.DeadlineExceeded {
+		return // Shutting down, the messages are received again once visible
+	}
+	switch {
+	case err != nil:
+		failAll(q, msgs, err.Error())
+		return
+	case res.Failed():
+		log.Printf("Queue %s: delivery of %d messages failed: status %d\n", q.Name(), len(msgs), res.Status)
+		failAll(q, msgs, fmt.Sprintf("status %d: %s", res.Status, strings.TrimSpace(string(res.Body))))
+		return
+	}
+
+	failed := map[string]bool{}
+	for _, v := range res.Header.Values(FailedHeader) {
+		for _, id := range strings.Split(v, ",") {
+			failed[strings.TrimSpace(id)] = true
+		}
+	}
+	for _, m := range msgs {
+		if failed[m.ID] {
+			err = q.Fail(m, "reported failed by the deployment")
+		} else {
+			err = q.Ack(m)
+		}
+		if err != nil {
+			log.Printf("Queue %s: message %s: %v\n", q.Name(), m.ID, err)
+		}
+	}
+}
+
+// failAll fails msgs because of reason.
+func failAll(q *Queue, msgs []Message, reason string) {
+	for _, m := range msgs {
+		if err := q.Fail(m, reason); err != nil {
+			log.Printf("Queue %s: message %s: %v\n", q.Name(), m.ID, err)
+		}
+	}
+}
@@ -0,0 +1,388 @@
+// Package queue implements named message queues persisted on local disk,
+// whose messages invoke the deployments subscribed to them.
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotFound is returned for queues that were not declared.
+	ErrNotFound = errors.New("queue not found")
+	// ErrStale is returned when acknowledging a message whose visibility
+	// timeout expired, which may have been received again since.
+	ErrStale = errors.New("message was received again since")
+	// ErrDeadLetter is returned when enqueueing to a dead-letter queue, which
+	// only receives messages that failed elsewhere.
+	ErrDeadLetter = errors.New("queue is a dead-letter queue")
+)
+
+// DeadLetterSuffix names the dead-letter queue of a queue without one set.
+const DeadLetterSuffix = ".dead"
+
+// Options configures a queue.
+type Options struct {
+	VisibilityTimeout time.Duration // How long a received message stays hidden before it is received again, 30s if zero
+	MaxAttempts       int           // Receptions before a message is dead-lettered, 5 if zero
+	Backoff           time.Duration // Delay before retrying a failed message, doubled on each attempt, 1s if zero
+	MaxBackoff        time.Duration // Bound of the retry delay, 5m if zero
+	DeadLetter        string        // Queue receiving messages that failed every attempt, the name with DeadLetterSuffix if empty
+}
+
+// withDefaults returns o with defaults for unset options.
+func (o Options) withDefaults(name string) Options {
+	if o.VisibilityTimeout <= 0 {
+		o.VisibilityTimeout = 30 * time.Second
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 5
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = time.Second
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 5 * time.Minute
+	}
+	if o.DeadLetter == "" {
+		o.DeadLetter = name + DeadLetterSuffix
+	}
+	return o
+}
+
+// Message is a message in a queue.
+type Message struct {
+	ID         string            `json:"id"`
+	Body       []byte            `json:"body"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Enqueued   time.Time         `json:"enqueued"`
+	Attempts   int               `json:"attempts"`        // Times the message was received
+	VisibleAt  time.Time         `json:"visible_at"`      // When the message can be received
+	Error      string            `json:"error,omitempty"` // Why the last attempt failed
+	Seq        uint64            `json:"seq"`             // Order of the message in its queue
+
+	leased bool // Received and neither acknowledged nor failed yet
+}
+
+// Queue is a named queue. Messages are received in order, unless delayed by
+// a retry, and stay in the queue until acknowledged.
+type Queue struct {
+	name   string
+	opts   Options
+	dir    string // Holds a file per message, none if empty
+	broker *Broker
+
+	mu     sync.Mutex
+	list   []*Message // Ordered by Seq
+	seq    uint64
+	signal chan struct{} // Closed when messages are enqueued
+}
+
+// Name returns the name of q.
+func (q *Queue) Name() string {
+	return q.name
+}
+
+// Options returns the options of q.
+func (q *Queue) Options() Options {
+	return q.opts
+}
+
+// IsDeadLetter reports whether q is a dead-letter queue, which keeps the
+// messages that fail in it.
+func (q *Queue) IsDeadLetter() bool {
+	return q.opts.DeadLetter == q.name
+}
+
+// Enqueue adds a message to q, which can be received after delay.
+func (q *Queue) Enqueue(body []byte, attributes map[string]string, delay time.Duration) (*Message, error) {
+	now := time.Now()
+	m := &Message{
+		ID:         uuid.NewString(),
+		Body:       body,
+		Attributes: attributes,
+		Enqueued:   now,
+		VisibleAt:  now.Add(max(delay, 0)),
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.push(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// push stores m at the end of q and wakes up receivers.
+func (q *Queue) push(m *Message) error {
+	q.seq++
+	m.Seq = q.seq
+	if err := q.save(m); err != nil {
+		return err
+	}
+	q.list = append(q.list, m)
+	close(q.signal)
+	q.signal = make(chan struct{})
+	return nil
+}
+
+// Receive returns up to max messages, waiting until at least one can be
+// received or ctx is done. The messages stay hidden for the visibility
+// timeout, and are received again if they are not acknowledged by then.
+func (q *Queue) Receive(ctx context.Context, max int) ([]Message, error) {
+	for {
+		q.mu.Lock()
+		msgs, wake := q.take(max, time.Now())
+		signal := q.signal
+		q.mu.Unlock()
+		if len(msgs) > 0 {
+			return msgs, nil
+		}
+
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if !wake.IsZero() {
+			timer = time.NewTimer(time.Until(wake))
+			expired = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return nil, ctx.Err()
+		case <-signal:
+		case <-expired:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// take leases up to max visible messages, dead-lettering those that were
+// received too many times. It returns when the next message becomes visible
+// if none is.
+func (q *Queue) take(max int, now time.Time) ([]Message, time.Time) {
+	var msgs []Message
+	var wake time.Time
+	for i := 0; i < len(q.list) && len(msgs) < max; i++ {
+		m := q.list[i]
+		if m.VisibleAt.After(now) {
+			if wake.IsZero() || m.VisibleAt.Before(wake) {
+				wake = m.VisibleAt
+			}
+			continue
+		}
+		if m.Attempts >= q.opts.MaxAttempts {
+			// The last attempt neither succeeded nor failed in time.
+			m.Error = "visibility timeout expired"
+			q.deadLetter(m)
+			if i < len(q.list) && q.list[i] == m {
+				if wake.IsZero() || m.VisibleAt.Before(wake) {
+					wake = m.VisibleAt
+				}
+			} else {
+				i--
+			}
+			continue
+		}
+
+		m.Attempts++
+		m.VisibleAt = now.Add(q.opts.VisibilityTimeout)
+		m.leased = true
+		if err := q.save(m); err != nil {
+			m.Attempts--
+			continue
+		}
+		msgs = append(msgs, *m)
+	}
+	return msgs, wake
+}
+
+// Ack removes the received message m from q.
+func (q *Queue) Ack(m Message) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i, err := q.find(m)
+	if err != nil {
+		return err
+	}
+	if err := q.remove(q.list[i]); err != nil {
+		return err
+	}
+	q.list = append(q.list[:i], q.list[i+1:]...)
+	return nil
+}
+
+// Fail reports that processing the received message m failed because of
+// reason. It is retried after a backoff, or dead-lettered after its last attempt.
+func (q *Queue) Fail(m Message, reason string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i, err := q.find(m)
+	if err != nil {
+		return err
+	}
+	cur := q.list[i]
+	cur.Error = reason
+	cur.leased = false
+	if cur.Attempts >= q.opts.MaxAttempts {
+		return q.deadLetter(cur)
+	}
+
+	backoff := q.opts.Backoff << (cur.Attempts - 1)
+	if backoff <= 0 || backoff > q.opts.MaxBackoff {
+		backoff = q.opts.MaxBackoff
+	}
+	cur.VisibleAt = time.Now().Add(backoff)
+	return q.save(cur)
+}
+
+// find returns the index of the received message m, if it was not received again since.
+func (q *Queue) find(m Message) (int, error) {
+	for i, cur := range q.list {
+		if cur.ID != m.ID {
+			continue
+		}
+		if cur.Attempts != m.Attempts || !cur.leased {
+			return 0, ErrStale
+		}
+		return i, nil
+	}
+	return 0, ErrStale
+}
+
+// deadLetter moves m to the dead-letter queue of q. A dead-letter queue keeps
+// its messages when they fail.
+func (q *Queue) deadLetter(m *Message) error {
+	dlq, ok := q.broker.Get(q.opts.DeadLetter)
+	if ok && dlq != q {
+		dead := *m
+		dead.Attempts, dead.VisibleAt, dead.leased = 0, time.Now(), false
+		dlq.mu.Lock()
+		err := dlq.push(&dead)
+		dlq.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	} else {
+		// Without a dead-letter queue the message is retried after the longest backoff.
+		m.Attempts, m.VisibleAt, m.leased = 0, time.Now().Add(q.opts.MaxBackoff), false
+		return q.save(m)
+	}
+
+	if err := q.remove(m); err != nil {
+		return err
+	}
+	for i, cur := range q.list {
+		if cur == m {
+			q.list = append(q.list[:i], q.list[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Stats describes the messages of a queue.
+type Stats struct {
+	Name       string `json:"name"`
+	Messages   int    `json:"messages"`
+	Ready      int    `json:"ready"`     // Can be received now
+	InFlight   int    `json:"in_flight"` // Received and not acknowledged yet
+	Delayed    int    `json:"delayed"`   // Delayed or waiting for a retry
+	DeadLetter string `json:"dead_letter,omitempty"`
+}
+
+// Stats returns the current statistics of q.
+func (q *Queue) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s := Stats{Name: q.name, Messages: len(q.list)}
+	if !q.IsDeadLetter() {
+		s.DeadLetter = q.opts.DeadLetter
+	}
+	now := time.Now()
+	for _, m := range q.list {
+		switch {
+		case m.leased && m.VisibleAt.After(now):
+			s.InFlight++
+		case m.VisibleAt.After(now):
+			s.Delayed++
+		default:
+			s.Ready++
+		}
+	}
+	return s
+}
+
+// save writes m to its file, if q is persisted.
+func (q *Queue) save(m *Message) error {
+	if q.dir == "" {
+		return nil
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(q.dir, m.ID+".json")
+	if err := os.WriteFile(path+".tmp", b, 0o644); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	return nil
+}
+
+// remove deletes the file of m, if q is persisted.
+func (q *Queue) remove(m *Message) error {
+	if q.dir == "" {
+		return nil
+	}
+	if err := os.Remove(filepath.Join(q.dir, m.ID+".json")); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove message: %w", err)
+	}
+	return nil
+}
+
+// load reads the messages of q from its directory. Messages received before a
+// restart are received again once their visibility timeout expires.
+func (q *Queue) load() error {
+	if err := os.MkdirAll(q.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create queue directory: %w", err)
+	}
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read queue directory: %w", err)
+	}
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(q.dir, e.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read message: %w", err)
+		}
+		var m Message
+		if err := json.Unmarshal(b, &m); err != nil {
+			return fmt.Errorf("failed to decode message %s: %w", e.Name(), err)
+		}
+		q.list = append(q.list, &m)
+		q.seq = max(q.seq, m.Seq)
+	}
+	sort.Slice(q.list, func(i, j int) bool {
+		return q.list[i].Seq < q.list[j].Seq
+	})
+	return nil
+}
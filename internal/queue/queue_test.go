@@ -0,0 +1,201 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func declare(t *testing.T, b *Broker, opts Options) *Queue {
+	t.Helper()
+	q, err := b.Declare("jobs", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func enqueue(t *testing.T, q *Queue, body string) *Message {
+	t.Helper()
+	m, err := q.Enqueue([]byte(body), nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestQueueVisibilityTimeout(t *testing.T) {
+	q := declare(t, NewBroker(""), Options{VisibilityTimeout: time.Minute})
+	enqueue(t, q, "a")
+	now := time.Now()
+
+	first, _ := q.take(1, now)
+	if len(first) != 1 || first[0].Attempts != 1 {
+		t.Fatalf("first take returned %+v, want the message on its first attempt", first)
+	}
+	if msgs, wake := q.take(1, now); len(msgs) != 0 || !wake.Equal(now.Add(time.Minute)) {
+		t.Fatalf("take of a received message returned %+v, waking at %s, want none until %s", msgs, wake, now.Add(time.Minute))
+	}
+
+	again, _ := q.take(1, now.Add(time.Minute))
+	if len(again) != 1 || again[0].ID != first[0].ID || again[0].Attempts != 2 {
+		t.Fatalf("take after the visibility timeout returned %+v, want the message on its second attempt", again)
+	}
+	if err := q.Ack(first[0]); !errors.Is(err, ErrStale) {
+		t.Fatalf("Ack of the expired reception returned %v, want ErrStale", err)
+	}
+	if err := q.Ack(again[0]); err != nil {
+		t.Fatal(err)
+	}
+	if s := q.Stats(); s.Messages != 0 {
+		t.Fatalf("queue holds %d messages after Ack, want none", s.Messages)
+	}
+}
+
+func TestQueueBackoff(t *testing.T) {
+	q := declare(t, NewBroker(""), Options{MaxAttempts: 10, Backoff: time.Second, MaxBackoff: 3 * time.Second})
+	enqueue(t, q, "a")
+
+	now := time.Now()
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		msgs, _ := q.take(1, now)
+		if len(msgs) != 1 {
+			t.Fatalf("take at %s returned no message", now)
+		}
+		before := time.Now()
+		if err := q.Fail(msgs[0], "failed"); err != nil {
+			t.Fatal(err)
+		}
+		after := time.Now()
+
+		m := q.list[0]
+		if m.VisibleAt.Before(before.Add(want)) || m.VisibleAt.After(after.Add(want)) {
+			t.Fatalf("attempt %d is retried after %s, want %s", msgs[0].Attempts, m.VisibleAt.Sub(before), want)
+		}
+		if m.Error != "failed" {
+			t.Fatalf("failed message has error %q, want %q", m.Error, "failed")
+		}
+		if err := q.Fail(msgs[0], "failed"); !errors.Is(err, ErrStale) {
+			t.Fatalf("second Fail of a reception returned %v, want ErrStale", err)
+		}
+		now = m.VisibleAt
+	}
+}
+
+func TestQueueDeadLetter(t *testing.T) {
+	tests := []struct {
+		name   string
+		fail   bool // Whether the last attempt fails, rather than expires
+		reason string
+	}{
+		{"failed", true, "status 500"},
+		{"expired", false, "visibility timeout expired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBroker("")
+			q := declare(t, b, Options{VisibilityTimeout: time.Minute, MaxAttempts: 2, Backoff: time.Second})
+			enqueue(t, q, "a")
+
+			now := time.Now()
+			msgs, _ := q.take(1, now)
+			if err := q.Fail(msgs[0], "status 500"); err != nil {
+				t.Fatal(err)
+			}
+			now = now.Add(time.Hour)
+			msgs, _ = q.take(1, now)
+			if len(msgs) != 1 || msgs[0].Attempts != 2 {
+				t.Fatalf("take returned %+v, want the message on its last attempt", msgs)
+			}
+			if tt.fail {
+				if err := q.Fail(msgs[0], tt.reason); err != nil {
+					t.Fatal(err)
+				}
+			} else if msgs, _ := q.take(1, now.Add(time.Minute)); len(msgs) != 0 {
+				t.Fatalf("take returned %+v after the last attempt, want none", msgs)
+			}
+
+			if s := q.Stats(); s.Messages != 0 {
+				t.Fatalf("queue holds %d messages, want none", s.Messages)
+			}
+			dlq, ok := b.Get("jobs" + DeadLetterSuffix)
+			if !ok {
+				t.Fatal("dead-letter queue was not declared")
+			}
+			dead, _ := dlq.take(1, time.Now())
+			if len(dead) != 1 || string(dead[0].Body) != "a" || dead[0].Error != tt.reason || dead[0].Attempts != 1 {
+				t.Fatalf("dead-letter queue holds %+v, want the message failed with %q", dead, tt.reason)
+			}
+
+			// Dead-letter queues keep their messages.
+			for range dlq.opts.MaxAttempts {
+				if err := dlq.Fail(dead[0], "failed again"); err != nil {
+					t.Fatal(err)
+				}
+				now = dlq.list[0].VisibleAt
+				if dead, _ = dlq.take(1, now); len(dead) != 1 {
+					t.Fatal("dead-letter queue lost its message")
+				}
+			}
+		})
+	}
+}
+
+func TestQueueReload(t *testing.T) {
+	dir := t.TempDir()
+	q := declare(t, NewBroker(dir), Options{VisibilityTimeout: time.Minute})
+	for _, body := range []string{"a", "b", "c"} {
+		enqueue(t, q, body)
+	}
+	now := time.Now()
+	received, _ := q.take(1, now)
+	acked, _ := q.take(1, now)
+	if err := q.Ack(acked[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// The messages are loaded in order by a new broker, as after a restart.
+	q = declare(t, NewBroker(dir), Options{VisibilityTimeout: time.Minute})
+	if s := q.Stats(); s.Messages != 2 || s.Ready != 1 || s.Delayed != 1 {
+		t.Fatalf("reloaded queue has %+v, want 2 messages of which 1 is ready", s)
+	}
+	if err := q.Ack(received[0]); !errors.Is(err, ErrStale) {
+		t.Fatalf("Ack of a reception before the restart returned %v, want ErrStale", err)
+	}
+	c := enqueue(t, q, "d")
+	if c.Seq != 4 {
+		t.Fatalf("message enqueued after the restart has sequence %d, want 4", c.Seq)
+	}
+
+	var got []string
+	for _, at := range []time.Time{now, now.Add(time.Minute), now.Add(time.Minute)} {
+		msgs, _ := q.take(1, at)
+		for _, m := range msgs {
+			got = append(got, string(m.Body))
+			if string(m.Body) == "a" && m.Attempts != 2 {
+				t.Fatalf("message received before the restart is on attempt %d, want 2", m.Attempts)
+			}
+			if err := q.Ack(m); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if want := []string{"c", "a", "d"}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Fatalf("reloaded queue delivered %q, want %q", got, want)
+	}
+}
+
+func TestBrokerEnqueue(t *testing.T) {
+	b := NewBroker("")
+	declare(t, b, Options{})
+	if err := b.Enqueue(context.Background(), "jobs", []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Enqueue(context.Background(), "jobs"+DeadLetterSuffix, []byte("a")); !errors.Is(err, ErrDeadLetter) {
+		t.Fatalf("Enqueue to the dead-letter queue returned %v, want ErrDeadLetter", err)
+	}
+	if err := b.Enqueue(context.Background(), "other", []byte("a")); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Enqueue to an undeclared queue returned %v, want ErrNotFound", err)
+	}
+}
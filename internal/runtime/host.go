@@ -0,0 +1,170 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	types "github.com/ASparkOfFire/ignis/internal/proto"
+	"github.com/ASparkOfFire/ignis/internal/protocol"
+	"github.com/ignis-runtime/wazero/api"
+)
+
+// hostModule is the host module providing Ignis's own functions to guests.
+const hostModule = "ignis"
+
+// hostFunctions are the functions of hostModule.
+var hostFunctions = []string{
+	"queue_enqueue",
+	"response_write",
+	"request_head",
+	"request_read",
+	"request_trailers",
+}
+
+// Results of host functions.
+const (
+	HostOK          uint32 = iota
+	HostInvalid            // The arguments are out of the guest's memory
+	HostFailed             // The host failed to carry out the call
+	HostUnavailable        // The host does not provide the function to this deployment
+)
+
+// Host provides the functions of the ignis host module. Nil functions are
+// unavailable to the guest.
+type Host struct {
+	// Enqueue adds a message to a queue.
+	Enqueue func(ctx context.Context, queue string, body []byte) error
+}
+
+// Request is the request of an invocation, which the guest reads with the
+// ignis.request_* host functions instead of from stdin. The body is read
+// straight into the guest's memory.
+type Request struct {
+	Head     []byte // FDRequest without body, encoded with Encoding, headers included
+	Body     io.Reader
+	Trailer  func() http.Header // Trailers, complete once Body returned io.EOF
+	Encoding protocol.Encoding
+}
+
+// instantiateHost instantiates the ignis host module, backed by host and the
+// request and response channel of r.
+func (r *Runtime) instantiateHost(host *Host) error {
+	if host == nil {
+		host = &Host{}
+	}
+	_, err := r.runtime.NewHostModuleBuilder(hostModule).
+		NewFunctionBuilder().
+		WithFunc(func(ctx context.Context, m api.Module, queuePtr, queueLen, bodyPtr, bodyLen uint32) uint32 {
+			if host.Enqueue == nil {
+				return HostUnavailable
+			}
+			queue, ok := m.Memory().Read(queuePtr, queueLen)
+			if !ok {
+				return HostInvalid
+			}
+			body, ok := m.Memory().Read(bodyPtr, bodyLen)
+			if !ok {
+				return HostInvalid
+			}
+			if err := host.Enqueue(ctx, string(queue), bytes.Clone(body)); err != nil {
+				fmt.Fprintf(r.stderr, "ignis: queue_enqueue: %v\n", err)
+				return HostFailed
+			}
+			return HostOK
+		}).
+		Export("queue_enqueue").
+		NewFunctionBuilder().
+		WithFunc(func(ctx context.Context, m api.Module, ptr, length uint32) uint32 {
+			if r.response == nil {
+				return HostUnavailable
+			}
+			b, ok := m.Memory().Read(ptr, length)
+			if !ok {
+				return HostInvalid
+			}
+			// A failed write means the host stopped reading the response.
+			if _, err := r.response.Write(b); err != nil {
+				return HostFailed
+			}
+			return HostOK
+		}).
+		Export("response_write").
+		NewFunctionBuilder().
+		WithFunc(func(ctx context.Context, m api.Module, ptr, capacity, sizePtr uint32) uint32 {
+			if r.request == nil {
+				return HostUnavailable
+			}
+			return writeSized(m, r.request.Head, ptr, capacity, sizePtr)
+		}).
+		Export("request_head").
+		NewFunctionBuilder().
+		WithFunc(func(ctx context.Context, m api.Module, ptr, capacity, nPtr uint32) uint32 {
+			if r.request == nil {
+				return HostUnavailable
+			}
+			buf, ok := m.Memory().Read(ptr, capacity)
+			if !ok {
+				return HostInvalid
+			}
+			n, err := readSome(r.request.Body, buf)
+			if err != nil {
+				fmt.Fprintf(r.stderr, "ignis: request_read: %v\n", err)
+				return HostFailed
+			}
+			if !m.Memory().WriteUint32Le(nPtr, uint32(n)) {
+				return HostInvalid
+			}
+			return HostOK
+		}).
+		Export("request_read").
+		NewFunctionBuilder().
+		WithFunc(func(ctx context.Context, m api.Module, ptr, capacity, sizePtr uint32) uint32 {
+			if r.request == nil {
+				return HostUnavailable
+			}
+			b, err := r.request.Encoding.Marshal(&types.Trailers{Header: protocol.FromHeader(r.request.Trailer())})
+			if err != nil {
+				fmt.Fprintf(r.stderr, "ignis: request_trailers: %v\n", err)
+				return HostFailed
+			}
+			return writeSized(m, b, ptr, capacity, sizePtr)
+		}).
+		Export("request_trailers").
+		Instantiate(r.ctx)
+	return err
+}
+
+// writeSized copies b to the guest's buffer at ptr if it fits in capacity,
+// and stores the length of b at sizePtr, so the guest can call again with a
+// larger buffer if it did not fit.
+func writeSized(m api.Module, b []byte, ptr, capacity, sizePtr uint32) uint32 {
+	if !m.Memory().WriteUint32Le(sizePtr, uint32(len(b))) {
+		return HostInvalid
+	}
+	if uint32(len(b)) <= capacity && !m.Memory().Write(ptr, b) {
+		return HostInvalid
+	}
+	return HostOK
+}
+
+// readSome reads at least a byte of r into buf, unless r is at EOF, in which
+// case it returns 0 and no error. An empty buf reads nothing.
+func readSome(r io.Reader, buf []byte) (int, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	for {
+		n, err := r.Read(buf)
+		switch {
+		case n > 0:
+			return n, nil
+		case err == io.EOF:
+			return 0, nil
+		case err != nil:
+			return 0, err
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ASparkOfFire/ignis/internal/protocol"
+	"github.com/ASparkOfFire/ignis/internal/runtime/js"
+
+	"github.com/ignis-runtime/wasi-go/imports/wasi_http"
+	"github.com/ignis-runtime/wazero"
+)
+
+// wasiModule is the host module providing WASI preview 1 (and the sockets extensions).
+const wasiModule = "wasi_snapshot_preview1"
+
+// handlerExports are the exports that let a module serve requests without _start.
+var handlerExports = []string{"wasi:http/incoming-handler#handle", "HTTP#handle"}
+
+// wasiHTTPModules are the host modules provided by wasi_http when it is enabled.
+var wasiHTTPModules = []string{"types", "streams", "poll", "default-outgoing-HTTP"}
+
+// Import identifies a function imported by a module.
+type Import struct {
+	Module string `json:"module"`
+	Name   string `json:"name"`
+}
+
+func (i Import) String() string {
+	return i.Module + "." + i.Name
+}
+
+// MemoryLimits describes the linear memory of a module in 64KiB pages.
+type MemoryLimits struct {
+	Min      uint32 `json:"min"`
+	Max      uint32 `json:"max,omitempty"`
+	HasMax   bool   `json:"has_max"`
+	Imported bool   `json:"imported"`
+}
+
+// Report describes what a module exports and which host capabilities it needs.
+type Report struct {
+	Engine       RuntimeEngine `json:"engine"`
+	HasStart     bool          `json:"has_start"`
+	AnswersProbe bool          `json:"answers_probe"` // Exports protocol.ProbeExport, or runs on the JS prelude
+	Handlers     []string      `json:"handlers,omitempty"`
+	Imports      []Import      `json:"imports"`
+	Memory       *MemoryLimits `json:"memory,omitempty"`
+	UsesWasiHTTP bool          `json:"uses_wasi_http"`
+	UsesSockets  bool          `json:"uses_sockets"`
+	Unsupported  []Import      `json:"unsupported,omitempty"`
+}
+
+// Validate returns an error if the module cannot be run by Ignis.
+func (r *Report) Validate() error {
+	if !r.HasStart && len(r.Handlers) == 0 {
+		return fmt.Errorf("module exports neither _start nor a handler (%s)", strings.Join(handlerExports, ", "))
+	}
+	if len(r.Unsupported) > 0 {
+		names := make([]string, len(r.Unsupported))
+		for i, imp := range r.Unsupported {
+			names[i] = imp.String()
+		}
+		return fmt.Errorf("module imports functions Ignis cannot provide: %s", strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// Inspect compiles a module without running it and reports its capabilities.
+// For the JS engine the embedded runtime is inspected and blob is the script.
+func Inspect(ctx context.Context, engine RuntimeEngine, blob []byte, wasiConfig *WasiConfig) (*Report, error) {
+	if wasiConfig == nil {
+		wasiConfig = defaultWasiConfig()
+	}
+
+	switch engine {
+	case RuntimeEngineWASM:
+	case RuntimeEngineJS:
+		if len(blob) == 0 {
+			return nil, fmt.Errorf("script is empty")
+		}
+		blob = js.Runtime
+	default:
+		return nil, fmt.Errorf("unsupported runtime engine %q", engine)
+	}
+
+	// The interpreter only decodes and validates, which is all we need here.
+	rt := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfigInterpreter())
+	defer rt.Close(ctx)
+
+	mod, err := rt.CompileModule(ctx, blob)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile module: %w", err)
+	}
+	defer mod.Close(ctx)
+
+	report := &Report{
+		Engine:       engine,
+		Imports:      []Import{},
+		UsesWasiHTTP: wasi_http.DetectWasiHttp(mod),
+	}
+
+	exports := mod.ExportedFunctions()
+	_, report.HasStart = exports["_start"]
+	_, report.AnswersProbe = exports[protocol.ProbeExport]
+	report.AnswersProbe = report.AnswersProbe || engine == RuntimeEngineJS
+	for _, name := range handlerExports {
+		if _, ok := exports[name]; ok {
+			report.Handlers = append(report.Handlers, name)
+		}
+	}
+
+	for _, fn := range mod.ImportedFunctions() {
+		moduleName, name, _ := fn.Import()
+		imp := Import{Module: moduleName, Name: name}
+		report.Imports = append(report.Imports, imp)
+
+		switch {
+		case moduleName == wasiModule:
+			if strings.HasPrefix(name, "sock_") {
+				report.UsesSockets = true
+			}
+		case isWasiHTTPModule(moduleName) && wasiConfig.EnableHttp:
+		case moduleName == hostModule && slices.Contains(hostFunctions, name):
+		default:
+			report.Unsupported = append(report.Unsupported, imp)
+		}
+	}
+	sort.Slice(report.Imports, func(i, j int) bool {
+		return report.Imports[i].String() < report.Imports[j].String()
+	})
+
+	for _, mem := range mod.ImportedMemories() {
+		report.Memory = memoryLimits(mem.Min(), mem.Max)
+		report.Memory.Imported = true
+	}
+	for _, mem := range mod.ExportedMemories() {
+		if report.Memory == nil {
+			report.Memory = memoryLimits(mem.Min(), mem.Max)
+		}
+	}
+
+	return report, nil
+}
+
+// memoryLimits builds MemoryLimits from a memory definition's bounds.
+func memoryLimits(min uint32, max func() (uint32, bool)) *MemoryLimits {
+	limits := &MemoryLimits{Min: min}
+	limits.Max, limits.HasMax = max()
+	return limits
+}
+
+// isWasiHTTPModule reports whether name is a host module provided by wasi_http.
+func isWasiHTTPModule(name string) bool {
+	if strings.HasPrefix(name, "wasi:http/") || strings.HasPrefix(name, "wasi:io/") {
+		return true
+	}
+	for _, m := range wasiHTTPModules {
+		if name == m {
+			return true
+		}
+	}
+	return false
+}
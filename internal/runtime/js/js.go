@@ -2,7 +2,43 @@ package js
 
 import (
 	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ASparkOfFire/ignis/internal/protocol"
 )
 
 //go:embed js.wasm
 var Runtime []byte
+
+// Prelude defines the Ignis helpers available to every script.
+//
+//go:embed prelude.js
+var Prelude string
+
+// MaxRequest is the size of the largest encoded request passed to a script.
+const MaxRequest = 4 << 20
+
+// ErrRequestTooLarge reports a request larger than MaxRequest.
+var ErrRequestTooLarge = fmt.Errorf("request exceeds %d bytes, the most JS deployments accept", MaxRequest)
+
+// Script returns script preceded by the prelude and the environment and
+// request it reads. The engine gives scripts writebytes but nothing to read
+// stdin with, so the request the host sent there is buffered and passed
+// along instead, which is why it is limited to MaxRequest.
+// Nor can scripts import host functions, so JS deployments never use the
+// response channel or the host request functions.
+// Protocol probes are answered by the prelude, so script is left out of them.
+func Script(env map[string]string, script, request []byte) string {
+	if env == nil {
+		env = map[string]string{}
+	}
+	if env[protocol.ProbeEnv] != "" {
+		script = nil
+	}
+	b, _ := json.Marshal(env) // A map of strings always encodes
+	return "globalThis.__ignisEnv = " + string(b) + ";\n" +
+		"globalThis.__ignisRequest = \"" + base64.StdEncoding.EncodeToString(request) + "\";\n" +
+		Prelude + "\n" + string(script)
+}
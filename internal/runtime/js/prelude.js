@@ -0,0 +1,498 @@
+// Ignis prelude, evaluated before every JS deployment script. The host defines
+// globalThis.__ignisEnv with the invocation's environment and
+// globalThis.__ignisRequest with the FDRequest it sent, base64 encoded, before
+// this file.
+//
+// Scripts read the request with Ignis.request(), which decodes the FDRequest
+// from the deployment's encoding, and answer with
+// Ignis.respond({ status, headers, body }), which encodes the FDResponse in it
+// and writes it to stdout.
+(function () {
+    const env = globalThis.__ignisEnv || {};
+
+    const CAP_ENCODING_PROTOBUF = 1 << 1;
+    const CAP_ENCODING_JSON = 1 << 2;
+    const CAP_ENCODING_CBOR = 1 << 3;
+    // The engine only gives scripts writebytes, which writes to stdout: they
+    // cannot call host functions, so the response channel and the host
+    // request functions are left out. The prelude speaks Version1, a single
+    // message each way, so the capabilities of framed streams are too.
+    const CAPABILITIES = CAP_ENCODING_PROTOBUF | CAP_ENCODING_JSON | CAP_ENCODING_CBOR;
+
+    // Not every engine ships TextEncoder; bodies are UTF-8 either way.
+    function utf8(str) {
+        if (typeof TextEncoder !== "undefined") {
+            return new TextEncoder().encode(str);
+        }
+        const out = [];
+        for (const ch of str) {
+            let c = ch.codePointAt(0);
+            if (c < 0x80) {
+                out.push(c);
+            } else if (c < 0x800) {
+                out.push(0xc0 | (c >> 6), 0x80 | (c & 0x3f));
+            } else if (c < 0x10000) {
+                out.push(0xe0 | (c >> 12), 0x80 | ((c >> 6) & 0x3f), 0x80 | (c & 0x3f));
+            } else {
+                out.push(0xf0 | (c >> 18), 0x80 | ((c >> 12) & 0x3f), 0x80 | ((c >> 6) & 0x3f), 0x80 | (c & 0x3f));
+            }
+        }
+        return new Uint8Array(out);
+    }
+
+    function fromUtf8(bytes) {
+        if (typeof TextDecoder !== "undefined") {
+            return new TextDecoder().decode(bytes);
+        }
+        let out = "";
+        for (let i = 0; i < bytes.length; ) {
+            const b = bytes[i++];
+            let c;
+            if (b < 0x80) {
+                c = b;
+            } else if (b < 0xe0) {
+                c = ((b & 0x1f) << 6) | (bytes[i++] & 0x3f);
+            } else if (b < 0xf0) {
+                c = ((b & 0x0f) << 12) | ((bytes[i++] & 0x3f) << 6) | (bytes[i++] & 0x3f);
+            } else {
+                c = ((b & 0x07) << 18) | ((bytes[i++] & 0x3f) << 12) | ((bytes[i++] & 0x3f) << 6) | (bytes[i++] & 0x3f);
+            }
+            out += String.fromCodePoint(c);
+        }
+        return out;
+    }
+
+    const B64 = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/";
+
+    function base64(bytes) {
+        let out = "";
+        for (let i = 0; i < bytes.length; i += 3) {
+            const n = (bytes[i] << 16) | ((bytes[i + 1] || 0) << 8) | (bytes[i + 2] || 0);
+            out += B64[(n >> 18) & 63] + B64[(n >> 12) & 63];
+            out += i + 1 < bytes.length ? B64[(n >> 6) & 63] : "=";
+            out += i + 2 < bytes.length ? B64[n & 63] : "=";
+        }
+        return out;
+    }
+
+    // unbase64 decodes standard or URL-safe base64, with or without padding.
+    function unbase64(str) {
+        const out = new Uint8Array(Math.floor((str.length * 3) / 4));
+        let n = 0;
+        let bits = 0;
+        let j = 0;
+        for (const ch of str) {
+            const v = B64.indexOf(ch === "-" ? "+" : ch === "_" ? "/" : ch);
+            if (v < 0) continue;
+            n = (n << 6) | v;
+            bits += 6;
+            if (bits >= 8) {
+                bits -= 8;
+                out[j++] = (n >> bits) & 0xff;
+                n &= (1 << bits) - 1;
+            }
+        }
+        return out.subarray(0, j);
+    }
+
+    // Protobuf, following internal/proto/types.proto.
+    function pbVarint(out, n) {
+        while (n >= 0x80) {
+            out.push((n % 0x80) | 0x80);
+            n = Math.floor(n / 0x80);
+        }
+        out.push(n);
+    }
+
+    function pbBytes(out, field, bytes) {
+        pbVarint(out, (field << 3) | 2);
+        pbVarint(out, bytes.length);
+        for (const b of bytes) out.push(b);
+    }
+
+    function pbUint(out, field, n) {
+        if (!n) return;
+        pbVarint(out, field << 3);
+        pbVarint(out, n);
+    }
+
+    function encodeProtobuf(msg) {
+        const out = [];
+        if (msg.Body && msg.Body.length) pbBytes(out, 1, msg.Body);
+        pbUint(out, 2, msg.StatusCode);
+        pbUint(out, 3, msg.Length);
+        for (const [key, values] of Object.entries(msg.Header || {})) {
+            const fields = [];
+            for (const v of values) pbBytes(fields, 1, utf8(v));
+            const entry = [];
+            pbBytes(entry, 1, utf8(key));
+            pbBytes(entry, 2, fields);
+            pbBytes(out, 4, entry);
+        }
+        pbUint(out, 5, msg.Version);
+        pbUint(out, 6, msg.Capabilities);
+        pbUint(out, 8, msg.MinVersion);
+        return new Uint8Array(out);
+    }
+
+    // JSON, following the canonical protobuf JSON mapping.
+    function encodeJSON(msg) {
+        const header = {};
+        for (const [key, values] of Object.entries(msg.Header || {})) {
+            header[key] = { fields: values };
+        }
+        return utf8(JSON.stringify({
+            Body: msg.Body && msg.Body.length ? base64(msg.Body) : undefined,
+            StatusCode: msg.StatusCode || undefined,
+            Length: msg.Length || undefined,
+            Header: header,
+            Version: msg.Version || undefined,
+            Capabilities: msg.Capabilities || undefined,
+        }));
+    }
+
+    // CBOR, as maps keyed by the JSON field names, following
+    // internal/protocol/cbor.go.
+    function cborHead(out, major, n) {
+        if (n < 24) {
+            out.push((major << 5) | n);
+        } else if (n < 0x100) {
+            out.push((major << 5) | 24, n);
+        } else if (n < 0x10000) {
+            out.push((major << 5) | 25, n >> 8, n & 0xff);
+        } else {
+            out.push((major << 5) | 26, (n >>> 24) & 0xff, (n >> 16) & 0xff, (n >> 8) & 0xff, n & 0xff);
+        }
+    }
+
+    function cborValue(out, v) {
+        if (typeof v === "number") {
+            cborHead(out, 0, v);
+        } else if (typeof v === "string") {
+            const b = utf8(v);
+            cborHead(out, 3, b.length);
+            for (const x of b) out.push(x);
+        } else if (v instanceof Uint8Array) {
+            cborHead(out, 2, v.length);
+            for (const x of v) out.push(x);
+        } else if (Array.isArray(v)) {
+            cborHead(out, 4, v.length);
+            for (const x of v) cborValue(out, x);
+        } else {
+            const entries = Object.entries(v).filter(([, x]) => x !== undefined);
+            cborHead(out, 5, entries.length);
+            for (const [k, x] of entries) {
+                cborValue(out, k);
+                cborValue(out, x);
+            }
+        }
+    }
+
+    function encodeCBOR(msg) {
+        const header = {};
+        for (const [key, values] of Object.entries(msg.Header || {})) {
+            header[key] = { fields: values };
+        }
+        const out = [];
+        cborValue(out, {
+            Body: msg.Body && msg.Body.length ? msg.Body : undefined,
+            StatusCode: msg.StatusCode || undefined,
+            Length: msg.Length || undefined,
+            Header: header,
+            Version: msg.Version || undefined,
+            Capabilities: msg.Capabilities || undefined,
+        });
+        return new Uint8Array(out);
+    }
+
+    const encoders = { protobuf: encodeProtobuf, json: encodeJSON, cbor: encodeCBOR };
+
+    // Protobuf decoding, for the fields of FDRequest that scripts read. Each
+    // schema maps field numbers to a name and a kind: a scalar, "strings" for
+    // repeated strings, "map" with the schema of its entries, or the schema of
+    // a nested message.
+    const pbSchemas = {
+        FDRequest: {
+            1: ["Method", "string"],
+            2: ["Header", "map", "HeaderEntry"],
+            3: ["Body", "bytes"],
+            4: ["ContentLength", "int"],
+            5: ["TransferEncoding", "StringSlice"],
+            6: ["Host", "string"],
+            7: ["RemoteAddr", "string"],
+            8: ["RequestURI", "string"],
+            9: ["Pattern", "string"],
+            10: ["Proto", "string"],
+            11: ["ProtoMajor", "int"],
+            12: ["ProtoMinor", "int"],
+            13: ["Scheme", "string"],
+            14: ["Version", "int"],
+            15: ["Capabilities", "int"],
+            16: ["DeploymentID", "string"],
+            17: ["InvocationID", "string"],
+            18: ["Deadline", "int"],
+            19: ["Traceparent", "string"],
+            20: ["Tracestate", "string"],
+            22: ["Event", "Event"],
+        },
+        HeaderEntry: { 1: ["key", "string"], 2: ["value", "HeaderFields"] },
+        HeaderFields: { 1: ["fields", "strings"] },
+        StringSlice: { 1: ["fields", "strings"] },
+        Event: {
+            1: ["ID", "string"],
+            2: ["Type", "string"],
+            3: ["Source", "string"],
+            4: ["Time", "int"],
+            5: ["Data", "bytes"],
+            6: ["Attributes", "map", "AttributeEntry"],
+        },
+        AttributeEntry: { 1: ["key", "string"], 2: ["value", "string"] },
+    };
+
+    // pbFields splits a protobuf message into [field number, value] pairs,
+    // where values are numbers for varints and Uint8Arrays otherwise.
+    function pbFields(bytes) {
+        const fields = [];
+        let i = 0;
+        // Numbers are exact up to 49 bits, which every length and time in a
+        // request fits in. Negative integers take ten bytes and are exact
+        // down to -2^49, which covers a ContentLength of -1.
+        function varint() {
+            let n = 0;
+            let mul = 1;
+            let size = 0;
+            let b;
+            do {
+                b = bytes[i++];
+                if (size++ < 7) n += (b & 0x7f) * mul;
+                mul *= 0x80;
+            } while (b & 0x80);
+            return size === 10 ? n - 2 ** 49 : n;
+        }
+        while (i < bytes.length) {
+            const tag = varint();
+            let value;
+            switch (tag % 8) {
+                case 0:
+                    value = varint();
+                    break;
+                case 1:
+                    value = bytes.subarray(i, (i += 8));
+                    break;
+                case 2: {
+                    const length = varint();
+                    value = bytes.subarray(i, (i += length));
+                    break;
+                }
+                case 5:
+                    value = bytes.subarray(i, (i += 4));
+                    break;
+                default:
+                    throw new Error(`unsupported protobuf wire type ${tag % 8}`);
+            }
+            fields.push([Math.floor(tag / 8), value]);
+        }
+        return fields;
+    }
+
+    function decodeProtobufMessage(bytes, schema) {
+        const msg = {};
+        for (const [field, value] of pbFields(bytes)) {
+            const spec = schema[field];
+            if (!spec) continue;
+            const [name, kind, entry] = spec;
+            switch (kind) {
+                case "string":
+                    msg[name] = fromUtf8(value);
+                    break;
+                case "bytes":
+                case "int":
+                    msg[name] = value;
+                    break;
+                case "strings":
+                    (msg[name] = msg[name] || []).push(fromUtf8(value));
+                    break;
+                case "map": {
+                    const e = decodeProtobufMessage(value, pbSchemas[entry]);
+                    (msg[name] = msg[name] || {})[e.key || ""] = e.value;
+                    break;
+                }
+                default:
+                    msg[name] = decodeProtobufMessage(value, pbSchemas[kind]);
+            }
+        }
+        return msg;
+    }
+
+    function decodeProtobuf(bytes) {
+        return decodeProtobufMessage(bytes, pbSchemas.FDRequest);
+    }
+
+    // JSON follows the canonical protobuf JSON mapping, in which bytes are
+    // base64 and 64-bit integers strings.
+    function decodeJSON(bytes) {
+        const msg = JSON.parse(fromUtf8(bytes));
+        if (msg.Body) msg.Body = unbase64(msg.Body);
+        if (msg.Event && msg.Event.Data) msg.Event.Data = unbase64(msg.Event.Data);
+        return msg;
+    }
+
+    function decodeCBOR(bytes) {
+        let i = 0;
+        function argument(info) {
+            if (info < 24) return info;
+            if (info > 27) throw new Error("unsupported CBOR length");
+            let n = 0;
+            for (let k = 0; k < 1 << (info - 24); k++) n = n * 256 + bytes[i++];
+            return n;
+        }
+        function item() {
+            const b = bytes[i++];
+            const major = b >> 5;
+            const info = b & 31;
+            if (major === 7) {
+                switch (info) {
+                    case 20:
+                        return false;
+                    case 21:
+                        return true;
+                    case 22:
+                    case 23:
+                        return null;
+                    default:
+                        throw new Error("unsupported CBOR simple value");
+                }
+            }
+            const n = argument(info);
+            switch (major) {
+                case 0:
+                    return n;
+                case 1:
+                    return -1 - n;
+                case 2:
+                    return bytes.subarray(i, (i += n));
+                case 3:
+                    return fromUtf8(bytes.subarray(i, (i += n)));
+                case 4: {
+                    const list = [];
+                    for (let k = 0; k < n; k++) list.push(item());
+                    return list;
+                }
+                case 5: {
+                    const map = {};
+                    for (let k = 0; k < n; k++) {
+                        const key = item();
+                        map[key] = item();
+                    }
+                    return map;
+                }
+                default:
+                    return item(); // The content of a tag
+            }
+        }
+        return item();
+    }
+
+    const decoders = { protobuf: decodeProtobuf, json: decodeJSON, cbor: decodeCBOR };
+
+    // toRequest converts a decoded FDRequest to what Ignis.request returns.
+    function toRequest(msg) {
+        const headers = {};
+        for (const [key, value] of Object.entries(msg.Header || {})) {
+            headers[key] = (value && value.fields) || [];
+        }
+        const event = msg.Event && {
+            id: msg.Event.ID || "",
+            type: msg.Event.Type || "",
+            source: msg.Event.Source || "",
+            time: Number(msg.Event.Time || 0),
+            data: msg.Event.Data || new Uint8Array(0),
+            attributes: msg.Event.Attributes || {},
+        };
+        const body = msg.Body || new Uint8Array(0);
+        return {
+            method: msg.Method || "GET",
+            uri: msg.RequestURI || "/",
+            host: msg.Host || "",
+            scheme: msg.Scheme || "http",
+            proto: msg.Proto || "",
+            remoteAddr: msg.RemoteAddr || "",
+            headers: headers,
+            body: body,
+            contentLength: Number(msg.ContentLength || 0),
+            deploymentId: msg.DeploymentID || "",
+            invocationId: msg.InvocationID || "",
+            deadline: Number(msg.Deadline || 0), // Unix time in milliseconds, 0 without deadline
+            traceparent: msg.Traceparent || "",
+            tracestate: msg.Tracestate || "",
+            event: event || undefined,
+
+            // header returns the first value of the header name, in any case.
+            header(name) {
+                const lower = name.toLowerCase();
+                for (const [key, values] of Object.entries(headers)) {
+                    if (key.toLowerCase() === lower) return values[0];
+                }
+                return undefined;
+            },
+            text() {
+                return fromUtf8(body);
+            },
+            json() {
+                return JSON.parse(fromUtf8(body));
+            },
+        };
+    }
+
+    function write(bytes) {
+        writebytes(new DataView(bytes.buffer, bytes.byteOffset, bytes.byteLength));
+    }
+
+    let request;
+
+    globalThis.Ignis = {
+        encoding: env.IGNIS_ENCODING || "protobuf",
+        utf8: utf8,
+
+        // request returns the request of this invocation: its method, uri,
+        // host, headers mapping names to lists of values, and body as a
+        // Uint8Array, with text() and json() to read it.
+        request() {
+            if (request) return request;
+            const decode = decoders[this.encoding];
+            if (!decode) {
+                throw new Error(`unknown encoding ${this.encoding}`);
+            }
+            const bytes = unbase64(globalThis.__ignisRequest || "");
+            request = toRequest(bytes.length ? decode(bytes) : {});
+            return request;
+        },
+
+        // respond writes the response. headers maps names to a value or a
+        // list of values; body is a string or a Uint8Array.
+        respond({ status = 200, headers = {}, body = "" } = {}) {
+            const encode = encoders[this.encoding];
+            if (!encode) {
+                throw new Error(`unknown encoding ${this.encoding}`);
+            }
+
+            const bytes = typeof body === "string" ? utf8(body) : body;
+            const header = {};
+            for (const [key, value] of Object.entries(headers)) {
+                header[key] = Array.isArray(value) ? value : [String(value)];
+            }
+            write(encode({
+                Body: bytes,
+                StatusCode: status,
+                Length: bytes.length,
+                Header: header,
+            }));
+        },
+    };
+
+    // A probe only asks what this prelude speaks, so the host leaves the
+    // script out. The answer is protobuf, which every host can decode.
+    if (env.IGNIS_PROTOCOL_PROBE) {
+        write(encodeProtobuf({ MinVersion: 1, Version: 1, Capabilities: CAPABILITIES }));
+    }
+})();
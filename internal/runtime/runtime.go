@@ -1,18 +1,24 @@
 package runtime
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 
 	"github.com/ASparkOfFire/ignis/internal/cache"
+	"github.com/ASparkOfFire/ignis/internal/protocol"
 	"github.com/ASparkOfFire/ignis/internal/runtime/js"
 
 	"github.com/google/uuid"
 	"github.com/ignis-runtime/wasi-go/imports"
 	"github.com/ignis-runtime/wasi-go/imports/wasi_http"
 	"github.com/ignis-runtime/wazero"
+	"github.com/ignis-runtime/wazero/api"
+	"github.com/ignis-runtime/wazero/sys"
 )
 
 //go:generate stringer --type RuntimeEngine
@@ -23,6 +29,11 @@ const (
 	RuntimeEngineJS
 )
 
+// MarshalText implements encoding.TextMarshaler so engines read well in JSON.
+func (e RuntimeEngine) MarshalText() ([]byte, error) {
+	return []byte(e.String()), nil
+}
+
 // NetworkConfig defines network-related configuration
 type NetworkConfig struct {
 	Listens []string // Network addresses to listen on
@@ -39,26 +50,34 @@ type WasiConfig struct {
 // Args defines the configuration for creating a new Runtime instance.
 type Args struct {
 	Stdout       io.Writer
+	Stderr       io.Writer // Optional, receives a copy of what the guest writes to stderr
 	DeploymentID uuid.UUID
 	Engine       RuntimeEngine
 	Blob         []byte
-	Cache        cache.ModCache[uuid.UUID]
+	Cache        cache.Cacher[cache.Digest]
 	Network      *NetworkConfig // Optional network configuration
 	Wasi         *WasiConfig    // Optional WASI configuration
+	Host         *Host          // Optional, backs the functions of the ignis host module
+	Response     io.Writer      // Optional, receives what the guest writes with ignis.response_write
+	Request      *Request       // Optional, read by the guest with the ignis.request_* functions
 }
 
 // Runtime manages the WebAssembly execution environment.
 type Runtime struct {
 	stdout       io.Writer
+	stderr       io.Writer
+	response     io.Writer // Response channel, unavailable to the guest if nil
+	request      *Request  // Read with host functions, unavailable to the guest if nil
 	ctx          context.Context
 	deploymentID uuid.UUID
 	engine       RuntimeEngine
 	mod          wazero.CompiledModule
 	runtime      wazero.Runtime
-	cache        cache.ModCache[uuid.UUID]
+	cache        cache.Cacher[cache.Digest]
 	network      *NetworkConfig
 	wasi         *WasiConfig
 	wasiHTTP     *wasi_http.WasiHTTP
+	release      func() // Releases the compilation cache once the runtime is closed
 }
 
 // defaultNetworkConfig returns default network configuration
@@ -91,13 +110,11 @@ func New(ctx context.Context, args Args) (*Runtime, error) {
 		wasiConfig = defaultWasiConfig()
 	}
 
-	if !args.Cache.Has(args.DeploymentID) {
-		args.Cache.Add(args.DeploymentID, wazero.NewCompilationCache())
+	stderr := io.Writer(os.Stderr)
+	if args.Stderr != nil {
+		stderr = io.MultiWriter(os.Stderr, args.Stderr)
 	}
 
-	config := wazero.NewRuntimeConfigCompiler().WithCompilationCache(args.Cache.Get(args.DeploymentID))
-	rt := wazero.NewRuntimeWithConfig(ctx, config)
-
 	blob := args.Blob
 	switch args.Engine {
 	case RuntimeEngineWASM:
@@ -105,15 +122,41 @@ func New(ctx context.Context, args Args) (*Runtime, error) {
 	case RuntimeEngineJS:
 		blob = js.Runtime
 	default:
-		rt.Close(ctx)
 		return nil, fmt.Errorf("unsupported runtime engine %q", args.Engine)
 	}
 
-	mod, err := rt.CompileModule(ctx, blob)
+	// Compiled artifacts are keyed by content, so identical modules share them
+	// and an updated module is compiled afresh.
+	key := cache.Sum(blob)
+	compilationCache, release, err := args.Cache.GetOrCreate(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Guests are stopped once ctx is done, so invocations can't outlive their deadline.
+	config := wazero.NewRuntimeConfigCompiler().
+		WithCompilationCache(compilationCache).
+		WithCloseOnContextDone(true)
+	rt := wazero.NewRuntimeWithConfig(ctx, config)
+
+	// Only one of several concurrent cold requests compiles; the others wait
+	// and then load the result from the shared compilation cache.
+	var mod wazero.CompiledModule
+	shared, err := args.Cache.Do(key, func() (err error) {
+		mod, err = rt.CompileModule(ctx, blob)
+		return err
+	})
+	if err == nil && shared {
+		mod, err = rt.CompileModule(ctx, blob)
+	}
 	if err != nil {
 		rt.Close(ctx) // Cleanup on failure
+		release()
 		return nil, fmt.Errorf("failed to compile module: %w", err)
 	}
+	// The module's size is only an estimate of its native code, used by
+	// caches that cannot measure what they hold.
+	args.Cache.SetSize(key, int64(len(blob)))
 
 	runtime := &Runtime{
 		runtime:      rt,
@@ -121,9 +164,13 @@ func New(ctx context.Context, args Args) (*Runtime, error) {
 		deploymentID: args.DeploymentID,
 		engine:       args.Engine,
 		stdout:       args.Stdout,
+		stderr:       stderr,
+		response:     args.Response,
+		request:      args.Request,
 		mod:          mod,
 		network:      network,
 		wasi:         wasiConfig,
+		release:      release,
 	}
 
 	// Set up enhanced WASI for WASM modules (this must happen after module compilation)
@@ -132,6 +179,10 @@ func New(ctx context.Context, args Args) (*Runtime, error) {
 			runtime.Close()
 			return nil, fmt.Errorf("failed to setup enhanced WASI: %w", err)
 		}
+		if err := runtime.instantiateHost(args.Host); err != nil {
+			runtime.Close()
+			return nil, fmt.Errorf("failed to instantiate host module: %w", err)
+		}
 	}
 
 	return runtime, nil
@@ -188,16 +239,47 @@ func (r *Runtime) Invoke(stdin io.Reader, env map[string]string, script []byte,
 
 	switch r.engine {
 	case RuntimeEngineWASM:
-		return r._invoke(stdin, env, nil, args...)
+		return r._invoke(stdin, env, nil, nil, args...)
 	case RuntimeEngineJS:
-		return r._invoke(stdin, env, script, args...)
+		return r._invoke(stdin, env, script, nil, args...)
 	default:
 		return fmt.Errorf("invalid runtime engine %d", r.engine)
 	}
 }
 
-// _invoke() implements combined logic for WASM and JS runtimes.
-func (r *Runtime) _invoke(stdin io.Reader, env map[string]string, script []byte, args ...string) error {
+// Serve dispatches req to the module's wasi-http incoming handler instead of
+// running _start, so no FDRequest is written to its stdin.
+func (r *Runtime) Serve(w http.ResponseWriter, req *http.Request, env map[string]string) error {
+	defer r.Close()
+
+	if r.wasiHTTP == nil {
+		return fmt.Errorf("module does not serve wasi-http requests")
+	}
+	if r.stdout == nil {
+		r.stdout = io.Discard
+	}
+	return r._invoke(http.NoBody, env, nil, func(ctx context.Context, mod api.Module) error {
+		r.wasiHTTP.MakeHandler(ctx, mod).ServeHTTP(w, req)
+		return nil
+	})
+}
+
+// _invoke() implements combined logic for WASM and JS runtimes. If serve is
+// not nil, the module is only initialized and serve is called with it.
+func (r *Runtime) _invoke(stdin io.Reader, env map[string]string, script []byte, serve func(context.Context, api.Module) error, args ...string) error {
+	// Scripts get the request along with the prelude, see js.Script.
+	var request []byte
+	if r.engine == RuntimeEngineJS {
+		var err error
+		if request, err = io.ReadAll(io.LimitReader(stdin, js.MaxRequest+1)); err != nil {
+			return fmt.Errorf("failed to read request: %w", err)
+		}
+		if len(request) > js.MaxRequest {
+			return js.ErrRequestTooLarge
+		}
+		stdin = bytes.NewReader(nil)
+	}
+
 	rStdin, wStdin, err := os.Pipe()
 	if err != nil {
 		return fmt.Errorf("failed to create stdin pipe: %w", err)
@@ -206,6 +288,10 @@ func (r *Runtime) _invoke(stdin io.Reader, env map[string]string, script []byte,
 	if err != nil {
 		return fmt.Errorf("failed to create stdout pipe: %w", err)
 	}
+	rStderr, wStderr, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create stderr pipe: %w", err)
+	}
 
 	// Async copy from user-provided stdin to pipe writer
 	go func() {
@@ -216,18 +302,41 @@ func (r *Runtime) _invoke(stdin io.Reader, env map[string]string, script []byte,
 	}()
 
 	// Async copy from pipe reader to user stdout
+	stdoutDone := make(chan struct{})
 	go func() {
+		defer close(stdoutDone)
 		defer rStdout.Close()
 		if _, err := io.Copy(r.stdout, rStdout); err != nil {
 			fmt.Fprintf(os.Stderr, "warning: failed copying from WASI stdout: %v\n", err)
 		}
 	}()
 
+	// Async copy from pipe reader to stderr
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(stderrDone)
+		defer rStderr.Close()
+		if _, err := io.Copy(r.stderr, rStderr); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed copying from WASI stderr: %v\n", err)
+		}
+	}()
+
+	// Runs after the instance and WASI system are closed: stdout only reaches
+	// EOF once our write end is closed too, and a streaming caller must see
+	// everything the guest wrote before Invoke returns.
+	defer func() {
+		wStdout.Close()
+		wStderr.Close()
+		rStdin.Close()
+		<-stdoutDone
+		<-stderrDone
+	}()
+
 	builder := imports.NewBuilder().
 		WithName(fmt.Sprintf("deployment-%s", r.deploymentID.String())).
 		WithSocketsExtension("auto", r.mod).
 		WithCustomDNSServer("1.1.1.1").
-		WithStdio(int(rStdin.Fd()), int(wStdout.Fd()), int(os.Stderr.Fd()))
+		WithStdio(int(rStdin.Fd()), int(wStdout.Fd()), int(wStderr.Fd()))
 
 	ctx, system, err := builder.Instantiate(r.ctx, r.runtime)
 	if err != nil {
@@ -236,12 +345,12 @@ func (r *Runtime) _invoke(stdin io.Reader, env map[string]string, script []byte,
 	defer system.Close(ctx)
 	r.ctx = ctx
 
-	// For JS, prepend the embedded script to args
+	// For JS, prepend the embedded script, behind the prelude, to args
 	if r.engine == RuntimeEngineJS {
 		if len(script) == 0 {
 			return fmt.Errorf("script argument is required for JS runtime")
 		}
-		jsArgs := []string{"", "-e", string(script)}
+		jsArgs := []string{"", "-e", js.Script(env, script, request)}
 		args = append(jsArgs, args...)
 	}
 
@@ -254,25 +363,42 @@ func (r *Runtime) _invoke(stdin io.Reader, env map[string]string, script []byte,
 		modConf = modConf.WithEnv(k, v)
 	}
 
+	// A served module is only initialized; reactors export _initialize
+	if serve != nil {
+		modConf = modConf.WithStartFunctions("_initialize")
+	}
+
 	// Set stdio bindings conditionally:
 	if r.engine == RuntimeEngineJS {
 		// JS runtime: direct user streams
-		modConf = modConf.WithStdin(stdin).WithStdout(r.stdout).WithStderr(os.Stderr)
+		modConf = modConf.WithStdin(stdin).WithStdout(r.stdout).WithStderr(r.stderr)
 	} else {
 		// WASM runtime: stdio handled by pipes (no explicit attached io.Reader/io.Writer)
 	}
 
 	instance, err := r.runtime.InstantiateModule(ctx, r.mod, modConf)
+	if exit := (*sys.ExitError)(nil); errors.As(err, &exit) && ctx.Err() == nil {
+		if exit.ExitCode() == protocol.ExitOK {
+			return nil
+		}
+		return &protocol.ExitError{Code: exit.ExitCode()}
+	}
 	if err != nil {
 		return fmt.Errorf("failed to instantiate module: %w", err)
 	}
 	defer instance.Close(ctx)
 
+	if serve != nil {
+		return serve(ctx, instance)
+	}
 	return nil
 }
 
 // Close shuts down the runtime and releases resources.
 func (r *Runtime) Close() error {
+	if r.release != nil {
+		defer r.release()
+	}
 	if r.runtime != nil {
 		if err := r.runtime.Close(r.ctx); err != nil {
 			return fmt.Errorf("failed to close runtime: %w", err)
@@ -0,0 +1,77 @@
+// Package trigger invokes deployments for events, such as cron schedules or
+// queue messages, rather than for requests made by clients.
+package trigger
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+
+	types "github.com/ASparkOfFire/ignis/internal/proto"
+	"github.com/ASparkOfFire/ignis/internal/protocol"
+)
+
+// maxBody bounds the response body kept in a Result.
+const maxBody = 1 << 10
+
+// Result is the response of a deployment to an event.
+type Result struct {
+	Status int
+	Header http.Header
+	Body   []byte // Start of the response body, enough to report errors
+}
+
+// Failed reports whether the deployment answered with an error status.
+func (r Result) Failed() bool {
+	return r.Status >= 400
+}
+
+// Invoke serves e with h as a POST request to path whose body is body. The
+// request carries e in its context, so the deployment receives it.
+func Invoke(ctx context.Context, h http.Handler, e *types.Event, path, contentType string, body []byte) (Result, error) {
+	req, err := http.NewRequestWithContext(protocol.WithEvent(ctx, e), http.MethodPost, path, bytes.NewReader(body))
+	if err != nil {
+		return Result{}, err
+	}
+	req.RequestURI = path
+	req.Host = "localhost"
+	req.RemoteAddr = e.Type
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "ignis-trigger")
+
+	rec := &recorder{header: http.Header{}}
+	h.ServeHTTP(rec, req)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return Result{Status: rec.status, Header: rec.header, Body: rec.body}, nil
+}
+
+// recorder is the http.ResponseWriter of events. It keeps the status, the
+// headers and the start of the body.
+type recorder struct {
+	header http.Header
+	status int
+	body   []byte
+}
+
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	if n := maxBody - len(r.body); n > 0 {
+		r.body = append(r.body, b[:min(n, len(b))]...)
+	}
+	return len(b), nil
+}
+
+// Flush implements http.Flusher, which streaming responses use.
+func (r *recorder) Flush() {}
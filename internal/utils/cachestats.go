@@ -0,0 +1,15 @@
+package utils
+
+import (
+	"net/http"
+
+	"github.com/ASparkOfFire/ignis/internal/cache"
+	"github.com/gin-gonic/gin"
+)
+
+// CacheStats responds with the hit, miss and eviction counters of the module cache.
+func CacheStats(modCache *cache.ModCache[cache.Digest]) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, modCache.Stats())
+	}
+}
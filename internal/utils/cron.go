@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"net/http"
+
+	"github.com/ASparkOfFire/ignis/internal/cache"
+	"github.com/ASparkOfFire/ignis/internal/cron"
+	"github.com/ASparkOfFire/ignis/internal/deployment"
+	"github.com/gin-gonic/gin"
+)
+
+// TriggerHandler serves the requests of d's triggers, whatever their path.
+func TriggerHandler(d *deployment.Deployment, cache cache.Cacher[cache.Digest]) http.Handler {
+	engine := gin.New()
+	engine.Any("/*path", WASIWrapper(d, cache))
+	return engine
+}
+
+// CronStatus responds with the state and recent runs of every trigger.
+func CronStatus(s *cron.Scheduler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"triggers": s.Status()})
+	}
+}
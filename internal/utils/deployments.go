@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"net/http"
+
+	"github.com/ASparkOfFire/ignis/internal/deployment"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ListDeployments responds with every registered deployment and its capability report.
+func ListDeployments(reg *deployment.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"deployments": reg.List()})
+	}
+}
+
+// GetDeployment responds with the deployment named by the :id parameter.
+func GetDeployment(reg *deployment.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deployment ID"})
+			return
+		}
+
+		d, ok := reg.Get(id)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Deployment not found"})
+			return
+		}
+		c.JSON(http.StatusOK, d)
+	}
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ASparkOfFire/ignis/internal/cache"
+	"github.com/ASparkOfFire/ignis/internal/deployment"
+	"github.com/ASparkOfFire/ignis/internal/protocol"
+	"github.com/gin-gonic/gin"
+)
+
+// gRPC status codes the host answers with.
+const (
+	grpcUnknown          = 2
+	grpcDeadlineExceeded = 4
+	grpcPermissionDenied = 7
+	grpcUnimplemented    = 12
+	grpcInternal         = 13
+	grpcUnavailable      = 14
+	grpcUnauthenticated  = 16
+)
+
+// GRPCWrapper serves gRPC calls with a deployment hosting a gRPC server, such
+// as grpc-go's, which receives them over HTTP/2 with their trailers. Other
+// requests are not found, so it can serve as gin's NoRoute handler.
+func GRPCWrapper(d *deployment.Deployment, cache cache.Cacher[cache.Digest]) gin.HandlerFunc {
+	serve := WASIWrapper(d, cache)
+	return func(c *gin.Context) {
+		if !isGRPC(c.Request) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		if c.Request.ProtoMajor < 2 {
+			logAndRespond(c, http.StatusHTTPVersionNotSupported, "gRPC requires HTTP/2", fmt.Errorf("received %s", c.Request.Proto))
+			return
+		}
+		if m := d.Module(); m.Mode == deployment.ModeStdio && m.Protocol < protocol.Version2 {
+			logAndRespond(c, http.StatusNotImplemented, "Deployment does not support gRPC", fmt.Errorf("protocol version %d has no trailers", m.Protocol))
+			return
+		}
+		serve(c)
+	}
+}
+
+// isGRPC reports whether r is a gRPC call, whose failures are answered with a
+// gRPC status.
+func isGRPC(r *http.Request) bool {
+	return r.Method == http.MethodPost && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// respondGRPCStatus answers a failed gRPC call with p as a trailers-only
+// response, which gRPC clients report as the status instead of a transport error.
+func respondGRPCStatus(c *gin.Context, p Problem) {
+	msg := p.Title
+	if p.Detail != "" {
+		msg += ": " + p.Detail
+	}
+	c.Header("Content-Type", "application/grpc")
+	c.Header("Grpc-Status", strconv.Itoa(grpcCode(p)))
+	c.Header("Grpc-Message", encodeGRPCMessage(msg))
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+}
+
+// grpcCode maps the status of p to a gRPC status code, following the mapping
+// gRPC clients apply to HTTP errors.
+func grpcCode(p Problem) int {
+	if p.Retryable {
+		return grpcUnavailable
+	}
+	switch p.Status {
+	case http.StatusBadRequest:
+		return grpcInternal
+	case http.StatusUnauthorized:
+		return grpcUnauthenticated
+	case http.StatusForbidden:
+		return grpcPermissionDenied
+	case http.StatusNotFound, http.StatusNotImplemented:
+		return grpcUnimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable:
+		return grpcUnavailable
+	case http.StatusGatewayTimeout:
+		return grpcDeadlineExceeded
+	default:
+		return grpcUnknown
+	}
+}
+
+// encodeGRPCMessage percent-encodes msg for the Grpc-Message header.
+func encodeGRPCMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		if c := msg[i]; c >= ' ' && c <= '~' && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"sync"
+
+	"github.com/ASparkOfFire/ignis/internal/protocol"
+	"github.com/gin-gonic/gin"
+)
+
+// maxStderr bounds the guest stderr kept for debug responses.
+const maxStderr = 16 << 10
+
+// Problem is an RFC 9457 problem details object, as answered to failures.
+type Problem = protocol.Problem
+
+// respondProblem sends p as an application/problem+json response, or as a
+// gRPC status to gRPC calls.
+func respondProblem(c *gin.Context, p Problem) {
+	if isGRPC(c.Request) {
+		respondGRPCStatus(c, p)
+		return
+	}
+	c.Header("Content-Type", "application/problem+json")
+	c.JSON(p.Status, p)
+}
+
+// stderrTail keeps the last maxStderr bytes written to it, where panics and
+// fatal errors end up.
+type stderrTail struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (t *stderrTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if over := len(t.buf) - maxStderr; over > 0 {
+		t.buf = append(t.buf[:0], t.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+// String returns the captured output. A nil stderrTail captured nothing.
+func (t *stderrTail) String() string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.buf)
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ASparkOfFire/ignis/internal/queue"
+	"github.com/gin-gonic/gin"
+)
+
+// maxMessage bounds the body of messages enqueued over HTTP.
+const maxMessage = 1 << 20
+
+// ListQueues responds with the statistics of every queue.
+func ListQueues(b *queue.Broker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stats := []queue.Stats{}
+		for _, q := range b.List() {
+			stats = append(stats, q.Stats())
+		}
+		c.JSON(http.StatusOK, gin.H{"queues": stats})
+	}
+}
+
+// EnqueueMessage adds the request body as a message to the queue named by the
+// :name parameter. Its Content-Type is kept as the content-type attribute, and
+// the delay query parameter postpones its delivery. Requests must carry token
+// as a bearer token, and dead-letter queues are refused.
+func EnqueueMessage(b *queue.Broker, token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bearer, _ := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+		q, ok := b.Get(c.Param("name"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Queue not found"})
+			return
+		}
+		if q.IsDeadLetter() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Queue is a dead-letter queue"})
+			return
+		}
+
+		var delay time.Duration
+		if d := c.Query("delay"); d != "" {
+			var err error
+			if delay, err = time.ParseDuration(d); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delay"})
+				return
+			}
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxMessage))
+		if err != nil {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Message too large"})
+			return
+		}
+
+		var attributes map[string]string
+		if ct := c.ContentType(); ct != "" {
+			attributes = map[string]string{"content-type": ct}
+		}
+		m, err := q.Enqueue(body, attributes, delay)
+		if err != nil {
+			logAndRespond(c, http.StatusInternalServerError, "Failed to enqueue message", err)
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"id": m.ID})
+	}
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"bytes"
+	"log"
+	"sync"
+
+	"github.com/ASparkOfFire/ignis/internal/protocol"
+)
+
+// maxLogLine bounds the lines of guest stdout logs; longer ones are split.
+const maxLogLine = 4 << 10
+
+// stdoutLog logs what a guest writes to stdout, a line at a time, once its
+// responses go through the response channel instead.
+type stdoutLog struct {
+	inv protocol.Invocation
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (l *stdoutLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		l.print(l.buf[:i])
+		l.buf = l.buf[i+1:]
+	}
+	if len(l.buf) >= maxLogLine {
+		l.print(l.buf)
+		l.buf = nil
+	}
+	return len(p), nil
+}
+
+// Close logs the last line, if the guest did not end it.
+func (l *stdoutLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.buf) > 0 {
+		l.print(l.buf)
+		l.buf = nil
+	}
+	return nil
+}
+
+func (l *stdoutLog) print(line []byte) {
+	log.Printf("Deployment %s: invocation %s: %s\n", l.inv.DeploymentID, l.inv.ID, line)
+}
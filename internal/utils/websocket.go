@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ASparkOfFire/ignis/internal/deployment"
+	"github.com/ASparkOfFire/ignis/internal/protocol"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// wsUpgrader terminates the WebSocket upgrades guests accept. Their origin
+// was checked before the guest was asked, see allowedOrigin.
+var wsUpgrader = websocket.Upgrader{
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// allowedOrigin reports whether the WebSocket upgrade r may be passed to d.
+// Browsers send the origin of the page asking, which must be the host's
+// unless d accepts any origin. Other clients send none.
+func allowedOrigin(d *deployment.Deployment, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if d.CrossOriginWebSockets || origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// acceptsWebSockets reports whether upgrade requests to m can be bridged.
+// Other modules receive them as regular requests.
+func acceptsWebSockets(m *deployment.Module) bool {
+	return m.Mode == deployment.ModeStdio &&
+		m.Protocol >= protocol.Version2 &&
+		m.Capabilities&protocol.CapWebSocket != 0
+}
+
+// bridgeWebSocket completes an upgrade the guest accepted and relays messages
+// between the client and the guest, whose stdin is written through fw, until
+// either side closes.
+func bridgeWebSocket(c *gin.Context, resp *protocol.Response, fw *protocol.Writer) error {
+	if fw == nil || resp.Stream == nil {
+		return fmt.Errorf("upgrade accepted outside of a framed stream")
+	}
+
+	header := http.Header{}
+	for k, v := range resp.Head.Header {
+		switch k := http.CanonicalHeaderKey(k); k {
+		case "Sec-Websocket-Protocol", "Set-Cookie":
+			header[k] = v.GetFields()
+		}
+	}
+	ws, err := wsUpgrader.Upgrade(c.Writer, c.Request, header)
+	if err != nil {
+		return err // The upgrader already answered the client
+	}
+	ws.SetReadLimit(protocol.MaxMessage)
+
+	// Client to guest.
+	clientDone := make(chan struct{})
+	go func() {
+		defer close(clientDone)
+		for {
+			messageType, data, err := ws.ReadMessage()
+			if err != nil {
+				code, text := websocket.CloseAbnormalClosure, ""
+				var ce *websocket.CloseError
+				if errors.As(err, &ce) {
+					code, text = ce.Code, ce.Text
+				}
+				fw.WriteWebSocketClose(code, text)
+				return
+			}
+			if err := fw.WriteWebSocketMessage(messageType, data); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Guest to client, until the guest closes or exits.
+	err = nil
+	for {
+		messageType, data, readErr := resp.Stream.ReadWebSocketMessage()
+		if readErr != nil {
+			code, text := websocket.CloseInternalServerErr, ""
+			var ce *protocol.CloseError
+			if errors.As(readErr, &ce) {
+				code, text = ce.Code, ce.Text
+			} else {
+				err = readErr
+			}
+			ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(time.Second))
+			break
+		}
+		if err = ws.WriteMessage(messageType, data); err != nil {
+			break
+		}
+	}
+
+	ws.Close()
+	<-clientDone
+	return err
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ASparkOfFire/ignis/internal/deployment"
+)
+
+func TestAllowedOrigin(t *testing.T) {
+	tests := []struct {
+		origin      string
+		crossOrigin bool
+		want        bool
+	}{
+		{"", false, true},
+		{"https://example.com", false, true},
+		{"https://EXAMPLE.com", false, true},
+		{"https://other.com", false, false},
+		{"https://example.com:8443", false, false},
+		{"https://other.com", true, true},
+		{"://invalid", false, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "http://example.com/ws", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		d := &deployment.Deployment{CrossOriginWebSockets: tt.crossOrigin}
+		if got := allowedOrigin(d, r); got != tt.want {
+			t.Errorf("allowedOrigin of %q with CrossOriginWebSockets %t = %t, want %t", tt.origin, tt.crossOrigin, got, tt.want)
+		}
+	}
+}
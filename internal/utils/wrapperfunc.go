@@ -1,7 +1,6 @@
 package utils
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -9,138 +8,308 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/ASparkOfFire/ignis/internal/cache"
-	types "github.com/ASparkOfFire/ignis/internal/proto"
+	"github.com/ASparkOfFire/ignis/internal/deployment"
+	"github.com/ASparkOfFire/ignis/internal/protocol"
 	"github.com/ASparkOfFire/ignis/internal/runtime"
+	"github.com/ASparkOfFire/ignis/internal/runtime/js"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
-	"google.golang.org/protobuf/proto"
+	"github.com/gorilla/websocket"
 )
 
+// disconnectGrace is how long a guest may keep running after its client went away.
+const disconnectGrace = 5 * time.Second
+
 // WASIWrapper initializes and executes a WASM runtime for processing HTTP requests.
-func WASIWrapper(wasmFile string, cache cache.ModCache[uuid.UUID], engine runtime.RuntimeEngine, id uuid.UUID) gin.HandlerFunc {
+// Request and response are exchanged in the protocol version negotiated with the
+// deployment, which streams bodies in frames from Version2 on. Failures are
+// answered with application/problem+json, which includes the error and the
+// guest's stderr for deployments in debug mode. Each invocation gets an ID, a
+// trace context and the deployment's deadline, after which the guest is stopped.
+// WebSocket upgrades the guest accepts are bridged for as long as they last,
+// and responses the guest flushes are flushed to the client.
+func WASIWrapper(d *deployment.Deployment, cache cache.Cacher[cache.Digest]) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		reqPayload, err := buildRequestPayload(c)
+		m, err := d.Load(c.Request.Context())
 		if err != nil {
-			logAndRespond(c, http.StatusInternalServerError, "Failed to process request", err)
+			logAndRespond(c, http.StatusInternalServerError, "Failed to load WASM module", err)
+			return
+		}
+		if d.Engine == runtime.RuntimeEngineJS && c.Request.ContentLength > js.MaxRequest {
+			logAndRespond(c, http.StatusRequestEntityTooLarge, "Request too large", js.ErrRequestTooLarge)
 			return
 		}
 
-		wasmBytes, err := os.ReadFile(wasmFile)
-		if err != nil {
-			logAndRespond(c, http.StatusInternalServerError, "Failed to read WASM file", err)
+		// A WebSocket lives as long as the client wants, so it gets no deadline.
+		upgrade := websocket.IsWebSocketUpgrade(c.Request) && acceptsWebSockets(m)
+		if upgrade && !allowedOrigin(d, c.Request) {
+			logAndRespond(c, http.StatusForbidden, "WebSocket origin not allowed", fmt.Errorf("origin %s", c.Request.Header.Get("Origin")))
 			return
 		}
+		timeout := d.Timeout
+		if upgrade {
+			timeout = 0
+		}
 
-		respProto, err := executeWASM(reqPayload, wasmBytes, cache, engine, id)
-		if err != nil {
-			logAndRespond(c, http.StatusInternalServerError, "Failed to execute WASM", err)
+		inv := protocol.NewInvocation(d.ID, c.Request, timeout)
+
+		// The guest is not stopped as soon as the client goes away, so it can
+		// notice it and clean up, but stop cancels it.
+		ctx, stop := context.WithCancel(context.WithoutCancel(c.Request.Context()))
+		defer stop()
+		if !inv.Deadline.IsZero() {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, inv.Deadline)
+			defer cancel()
+		}
+
+		var stderr *stderrTail
+		if d.Debug {
+			stderr = &stderrTail{}
+		}
+
+		if m.Mode == deployment.ModeWasiHTTP {
+			defer context.AfterFunc(c.Request.Context(), stop)()
+			serveWasiHTTP(ctx, c, d, inv, stderr, m.Blob, cache)
 			return
 		}
 
-		sendResponse(c, respProto)
-	}
-}
+		version := m.Protocol
+		stdin, stdinW := io.Pipe()
+		stdout, stdoutW := io.Pipe()
+		gio := guestIO{stdin: stdin, stdout: stdoutW}
 
-// buildRequestPayload constructs a protobuf request payload from the Gin context.
-func buildRequestPayload(c *gin.Context) ([]byte, error) {
-	body, err := io.ReadAll(c.Request.Body)
-	if err != nil && (!errors.Is(err, io.EOF) || len(body) > 0) {
-		return nil, fmt.Errorf("error reading request body: %w", err)
-	}
+		// Guests that read requests with host functions get an empty stdin.
+		if !upgrade && version >= protocol.Version2 && m.Capabilities&protocol.CapHostRequest != 0 {
+			head, err := protocol.EncodeRequestHead(c.Request, inv, version, d.Encoding)
+			if err != nil {
+				logAndRespond(c, http.StatusInternalServerError, "Failed to encode request", err)
+				return
+			}
+			gio.request = &runtime.Request{
+				Head:     head,
+				Body:     c.Request.Body,
+				Trailer:  func() http.Header { return c.Request.Trailer }, // Set once the body is read
+				Encoding: d.Encoding,
+			}
+		}
 
-	headers := make(map[string]*types.HeaderFields, len(c.Request.Header))
-	for k, v := range c.Request.Header {
-		headers[k] = &types.HeaderFields{Fields: v}
-	}
+		// After an upgrade stdin stays open for messages, written through fw.
+		var fw *protocol.Writer
+		reqDone := make(chan struct{})
+		go func() {
+			defer close(reqDone)
+			switch {
+			case gio.request != nil:
+				stdinW.Close()
+				return
+			case upgrade:
+				var err error
+				if fw, err = protocol.WriteUpgrade(stdinW, c.Request, inv, d.Encoding); err != nil {
+					stdinW.CloseWithError(err)
+				}
+				return
+			}
+			stdinW.CloseWithError(protocol.WriteRequest(stdinW, c.Request, inv, version, d.Encoding))
+		}()
+
+		// Guests with a response channel answer through it, and their
+		// stdout is logged.
+		if m.Capabilities&protocol.CapResponseChannel != 0 {
+			stdoutLog := &stdoutLog{inv: inv}
+			defer stdoutLog.Close()
+			gio.stdout, gio.response = stdoutLog, stdoutW
+		}
+
+		execDone := make(chan struct{})
+		go func() {
+			defer close(execDone)
+			env := map[string]string{protocol.EncodingEnv: string(d.Encoding)}
+			err := executeWASM(ctx, d, inv, gio, stderr, env, m.Blob, cache)
+			stdin.Close() // Unblock the request writer if the guest stopped reading
+			stdoutW.CloseWithError(err)
+		}()
+
+		// The request body must not be touched once the handler returns.
+		defer func() {
+			stdinW.Close()
+			stdout.Close()
+			<-execDone
+			<-reqDone
+		}()
+
+		// Once the client goes away, the guest's next write fails, which
+		// cancels its request's context. It is stopped after a grace period.
+		defer context.AfterFunc(c.Request.Context(), func() {
+			stdout.Close()
+			time.AfterFunc(disconnectGrace, stop)
+		})()
+
+		// fail answers with p once the guest has exited, so its stderr is complete.
+		fail := func(p Problem, err error) {
+			stdout.Close()
+			<-execDone
+			respondFailure(c, d, inv, p, err, stderr)
+		}
+
+		resp, err := protocol.ReadResponse(stdout, d.Encoding)
+		if err != nil {
+			fail(executionProblem(ctx, err), err)
+			return
+		}
 
-	reqMsg := &types.FDRequest{
-		Method:           c.Request.Method,
-		Header:           headers,
-		Body:             body,
-		ContentLength:    c.Request.ContentLength,
-		TransferEncoding: &types.StringSlice{Fields: c.Request.TransferEncoding},
-		Host:             c.Request.Host,
-		RemoteAddr:       c.Request.RemoteAddr,
-		RequestURI:       c.Request.RequestURI,
-		Pattern:          c.Request.Pattern,
+		if err := protocol.CheckVersion(version, resp.Head.Version); err != nil {
+			fail(Problem{Title: "Incompatible WASM module", Status: http.StatusBadGateway}, err)
+			return
+		}
+		if resp.Head.Error != nil {
+			fail(protocol.GuestProblem(resp.Head), &protocol.GuestError{Err: resp.Head.Error})
+			return
+		}
+		if err := protocol.ValidateResponse(resp.Head); err != nil {
+			fail(Problem{Title: "Invalid WASM response", Status: http.StatusBadGateway}, err)
+			return
+		}
+
+		if upgrade && resp.Head.StatusCode == http.StatusSwitchingProtocols {
+			<-reqDone
+			if err := bridgeWebSocket(c, resp, fw); err != nil {
+				log.Printf("WebSocket failed: invocation %s: %v\n", inv.ID, err)
+			}
+			return
+		}
+
+		sendResponse(c, resp)
 	}
+}
 
-	return proto.Marshal(reqMsg)
+// guestIO are the streams of a guest. A nil response or request leaves the
+// guest without the host functions writing the response or reading the request.
+type guestIO struct {
+	stdin    io.Reader
+	stdout   io.Writer
+	response io.Writer
+	request  *runtime.Request
 }
 
-// executeWASM runs the WASM binary and returns the parsed response.
-func executeWASM(reqPayload, wasmBytes []byte, cache cache.ModCache[uuid.UUID], engine runtime.RuntimeEngine, id uuid.UUID) (*types.FDResponse, error) {
-	// create a new buffer for output
-	fd := new(bytes.Buffer)
-	
-	// create a reader for the request payload
-	stdin := bytes.NewReader(reqPayload)
-
-	rt, err := runtime.New(context.Background(), runtime.Args{
-		Stdout:       fd,
-		DeploymentID: id,
-		Engine:       engine,
+// newRuntime initializes a runtime for d, which is stopped once ctx is done.
+func newRuntime(ctx context.Context, d *deployment.Deployment, gio guestIO, stderr *stderrTail, wasmBytes []byte, cache cache.Cacher[cache.Digest]) (*runtime.Runtime, error) {
+	args := runtime.Args{
+		Stdout:       gio.stdout,
+		Response:     gio.response,
+		Request:      gio.request,
+		DeploymentID: d.ID,
+		Engine:       d.Engine,
 		Blob:         wasmBytes,
 		Cache:        cache,
-	})
+		Wasi:         d.Wasi,
+		Host:         d.Host,
+	}
+	if stderr != nil {
+		args.Stderr = stderr
+	}
+	rt, err := runtime.New(ctx, args)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize WASM runtime: %w", err)
 	}
+	return rt, nil
+}
+
+// executeWASM runs the WASM binary for inv, streaming gio's stdin to it and
+// its output to gio's stdout, or to gio's response if it answers through the
+// response channel. The guest is stopped once ctx is done.
+func executeWASM(ctx context.Context, d *deployment.Deployment, inv protocol.Invocation, gio guestIO, stderr *stderrTail, env map[string]string, wasmBytes []byte, cache cache.Cacher[cache.Digest]) error {
+	rt, err := newRuntime(ctx, d, gio, stderr, wasmBytes, cache)
+	if err != nil {
+		return err
+	}
 
 	var script []byte
-	if engine == runtime.RuntimeEngineJS {
+	if d.Engine == runtime.RuntimeEngineJS {
 		script = wasmBytes
 	}
 
-	fmt.Printf("Invoking WASM with payload of size: %d\n", len(reqPayload))
-	if err := rt.Invoke(stdin, nil, script); err != nil {
-		return nil, fmt.Errorf("failed to invoke WASM runtime: %w", err)
+	fmt.Printf("Invoking WASM for deployment %s (invocation %s)\n", inv.DeploymentID, inv.ID)
+	if err := rt.Invoke(gio.stdin, env, script); err != nil {
+		return fmt.Errorf("failed to invoke WASM runtime: %w", err)
 	}
 	fmt.Printf("WASM invocation completed\n")
 
-	responseBytes, err := readStdout(fd)
+	return nil
+}
+
+// serveWasiHTTP dispatches the request through the module's wasi-http incoming
+// handler. Failures can only be answered with a problem if the guest has not
+// started its response.
+func serveWasiHTTP(ctx context.Context, c *gin.Context, d *deployment.Deployment, inv protocol.Invocation, stderr *stderrTail, wasmBytes []byte, cache cache.Cacher[cache.Digest]) {
+	rt, err := newRuntime(ctx, d, guestIO{stdout: os.Stdout}, stderr, wasmBytes, cache)
 	if err != nil {
-		return nil, err
+		logAndRespond(c, http.StatusInternalServerError, "Failed to execute WASM", err)
+		return
 	}
-	fmt.Printf("Read %d bytes from WASM output\n", len(responseBytes))
 
-	return parseWASMResponse(responseBytes)
-}
+	req := c.Request.WithContext(ctx)
+	req.Header.Set("Traceparent", inv.Traceparent)
 
-// readStdout reads and returns data from the in-memory file descriptor.
-func readStdout(fd *bytes.Buffer) ([]byte, error) {
-	// Read all data from the buffer
-	data := fd.Bytes()
-	if len(data) == 0 {
-		return nil, fmt.Errorf("no data read from WASM")
+	log.Printf("Serving wasi-http for deployment %s (invocation %s)\n", inv.DeploymentID, inv.ID)
+	err = rt.Serve(c.Writer, req, nil)
+	if err == nil {
+		return
 	}
-	return data, nil
+	if c.Writer.Written() {
+		log.Printf("Failed to serve wasi-http: invocation %s: %v\n", inv.ID, err)
+		return
+	}
+	respondFailure(c, d, inv, executionProblem(ctx, err), err, stderr)
 }
 
-// parseWASMResponse unmarshals the WASM response into a struct.
-func parseWASMResponse(data []byte) (*types.FDResponse, error) {
-	var respProto types.FDResponse
-	if err := proto.Unmarshal(data, &respProto); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+// executionProblem describes a guest that failed to produce a response with err.
+func executionProblem(ctx context.Context, err error) Problem {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return Problem{Title: "WASM execution timed out", Status: http.StatusGatewayTimeout}
+	}
+	if errors.Is(err, js.ErrRequestTooLarge) {
+		return Problem{Title: "Request too large", Status: http.StatusRequestEntityTooLarge}
 	}
-	return &respProto, nil
+	return Problem{Title: "Failed to execute WASM", Status: http.StatusInternalServerError}
 }
 
-// sendResponse formats and sends the WASM response to the client.
-func sendResponse(c *gin.Context, protoResp *types.FDResponse) {
-	for k, v := range protoResp.Header {
-		for _, val := range v.Fields {
-			c.Header(k, val)
+// respondFailure logs err and answers inv with p, adding err and the guest's
+// stderr for deployments in debug mode.
+func respondFailure(c *gin.Context, d *deployment.Deployment, inv protocol.Invocation, p Problem, err error, stderr *stderrTail) {
+	log.Printf("%s: invocation %s: %v\n", p.Title, inv.ID, err)
+	p.Instance = "urn:uuid:" + inv.ID.String()
+	if d.Debug {
+		if p.Detail == "" {
+			p.Detail = err.Error()
 		}
+		p.Stderr = stderr.String()
 	}
+	respondProblem(c, p)
+}
 
-	c.Data(int(protoResp.StatusCode), "application/octet-stream", protoResp.Body)
+// sendResponse sends the WASM response to the client. The body is copied as
+// it streams in, followed by any trailers.
+func sendResponse(c *gin.Context, resp *protocol.Response) {
+	protocol.WriteResponseHeader(c.Writer, resp.Head)
+	if resp.Stream != nil {
+		resp.Stream.OnFlush(c.Writer.Flush) // Server-sent events and the like reach the client right away
+	}
+	if _, err := io.Copy(c.Writer, resp.Body); err != nil {
+		log.Printf("Failed to stream response: %v\n", err)
+		if isGRPC(c.Request) && resp.Trailer.Get("Grpc-Status") == "" {
+			c.Writer.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(grpcInternal))
+		}
+		return
+	}
+	protocol.WriteResponseTrailer(c.Writer, resp.Trailer)
 }
 
-// logAndRespond logs the error and sends an HTTP response with an error message.
+// logAndRespond logs the error and sends a problem+json response titled msg.
 func logAndRespond(c *gin.Context, status int, msg string, err error) {
 	log.Printf("%s: %v\n", msg, err)
-	c.JSON(status, gin.H{"error": msg})
+	respondProblem(c, Problem{Title: msg, Status: status})
 }
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ASparkOfFire/ignis/internal/deployment"
+	"github.com/ASparkOfFire/ignis/internal/local"
+	"github.com/ASparkOfFire/ignis/internal/protocol"
+	"github.com/ASparkOfFire/ignis/internal/runtime"
+	"github.com/google/uuid"
+)
+
+// invokeUsage describes the invoke subcommand.
+const invokeUsage = `usage: ignis invoke [flags] module [request]
+
+Runs module once against a request and prints its response. The request file
+is either a raw HTTP request or a JSON object such as
+  {"method": "POST", "url": "/path?q=1", "headers": {"Content-Type": "text/plain"}, "body": "hello"}
+A request of "-" is read from stdin; without one the module gets GET /.
+
+Flags:
+`
+
+// invocationResult is what invoke prints.
+type invocationResult struct {
+	Status   int               `json:"status"`
+	Headers  http.Header       `json:"headers"`
+	Body     string            `json:"body"`
+	Base64   bool              `json:"base64,omitempty"` // Body is base64, as it is not UTF-8
+	Trailers http.Header       `json:"trailers,omitempty"`
+	Error    string            `json:"error,omitempty"`  // Reported by the guest in place of, or while streaming, the response
+	Stdout   string            `json:"stdout,omitempty"` // Logged by modules answering through the response channel
+	Stderr   string            `json:"stderr"`
+	Protocol uint32            `json:"protocol"`
+	Encoding protocol.Encoding `json:"encoding"`
+	Mode     deployment.Mode   `json:"mode"`
+	Compile  time.Duration     `json:"compile_ns"` // Inspecting, negotiating and compiling the module
+	Run      time.Duration     `json:"run_ns"`
+}
+
+// invoke implements the invoke subcommand and returns the exit code: 0 if the
+// module answered, 1 if it failed to, and 2 for usage errors.
+func invoke(args []string) int {
+	flags := flag.NewFlagSet("invoke", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), invokeUsage)
+		flags.PrintDefaults()
+	}
+	engine := flags.String("engine", "", "runtime engine, wasm or js (guessed from the module's extension if empty)")
+	encoding := flags.String("encoding", "", "encoding of the protocol messages: protobuf, json or cbor")
+	timeout := flags.Duration("timeout", time.Minute, "deadline of the invocation (none if zero)")
+	wasiHTTP := flags.Bool("wasi-http", false, "serve modules exporting a wasi-http handler through it")
+	asJSON := flags.Bool("json", false, "print the result as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		return 2
+	}
+
+	spec := deployment.Spec{
+		ID:       uuid.New(),
+		Path:     flags.Arg(0),
+		Encoding: protocol.Encoding(*encoding),
+		Timeout:  *timeout,
+		Debug:    true,
+		Wasi:     &runtime.WasiConfig{MaxOpenFiles: 1024, EnableHttp: *wasiHTTP},
+	}
+	switch {
+	case *engine == "js" || *engine == "" && filepath.Ext(spec.Path) == ".js":
+		spec.Engine = runtime.RuntimeEngineJS
+	case *engine == "wasm" || *engine == "":
+		spec.Engine = runtime.RuntimeEngineWASM
+	default:
+		fmt.Fprintf(os.Stderr, "unknown engine %q\n", *engine)
+		return 2
+	}
+
+	req, err := readRequest(flags.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read request: %v\n", err)
+		return 2
+	}
+
+	res, err := runInvocation(spec, req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invocation failed: %v\n", err)
+		if res != nil && res.Stderr != "" {
+			fmt.Fprintf(os.Stderr, "--- stderr ---\n%s", res.Stderr)
+		}
+		return 1
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(res)
+	} else {
+		printResult(os.Stdout, res)
+	}
+	return 0
+}
+
+// runInvocation runs the module of spec once with req.
+func runInvocation(spec deployment.Spec, req *http.Request) (*invocationResult, error) {
+	r, err := local.Run(spec, req)
+	if r == nil {
+		return nil, err
+	}
+	res := &invocationResult{
+		Status:   r.Status,
+		Headers:  r.Header,
+		Trailers: r.Trailer,
+		Stdout:   r.Stdout,
+		Stderr:   r.Stderr,
+		Protocol: r.Protocol,
+		Encoding: r.Encoding,
+		Mode:     r.Mode,
+		Compile:  r.Compile,
+		Run:      r.Run,
+	}
+	if r.Error != nil {
+		res.Error = (&protocol.GuestError{Err: r.Error}).Error()
+	}
+	res.setBody(r.Body)
+	return res, err
+}
+
+// setBody sets the body of res, in base64 unless it is UTF-8.
+func (res *invocationResult) setBody(body []byte) {
+	if utf8.Valid(body) {
+		res.Body = string(body)
+		return
+	}
+	res.Body, res.Base64 = base64.StdEncoding.EncodeToString(body), true
+}
+
+// printResult prints res like an HTTP response, followed by the guest's
+// output and timings.
+func printResult(w io.Writer, res *invocationResult) {
+	fmt.Fprintf(w, "HTTP/1.1 %d %s\n", res.Status, http.StatusText(res.Status))
+	printHeader(w, res.Headers)
+	fmt.Fprintln(w)
+	if res.Base64 {
+		fmt.Fprintf(w, "(base64) %s\n", res.Body)
+	} else if res.Body != "" {
+		fmt.Fprint(w, res.Body)
+		if !strings.HasSuffix(res.Body, "\n") {
+			fmt.Fprintln(w)
+		}
+	}
+	if len(res.Trailers) > 0 {
+		fmt.Fprintln(w, "--- trailers ---")
+		printHeader(w, res.Trailers)
+	}
+	if res.Error != "" {
+		fmt.Fprintf(w, "--- error ---\n%s\n", res.Error)
+	}
+	printOutput(w, "stdout", res.Stdout)
+	printOutput(w, "stderr", res.Stderr)
+	fmt.Fprintf(w, "--- %s, protocol %d, %s encoding: compile %s, run %s ---\n", res.Mode, res.Protocol, res.Encoding, res.Compile.Round(time.Microsecond), res.Run.Round(time.Microsecond))
+}
+
+// printOutput prints what the module wrote to the stream named name, if anything.
+func printOutput(w io.Writer, name, output string) {
+	if output == "" {
+		return
+	}
+	fmt.Fprintf(w, "--- %s ---\n%s", name, output)
+	if !strings.HasSuffix(output, "\n") {
+		fmt.Fprintln(w)
+	}
+}
+
+// printHeader prints h sorted by name.
+func printHeader(w io.Writer, h http.Header) {
+	names := make([]string, 0, len(h))
+	for k := range h {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		for _, v := range h[k] {
+			fmt.Fprintf(w, "%s: %s\n", k, v)
+		}
+	}
+}
+
+// requestFile is the JSON form of a request file.
+type requestFile struct {
+	Method  string                  `json:"method"`
+	URL     string                  `json:"url"`
+	Host    string                  `json:"host"`
+	Headers map[string]headerValues `json:"headers"`
+	Body    string                  `json:"body"`
+	Base64  bool                    `json:"base64"` // Body is base64
+}
+
+// headerValues are the values of a header, given as a string or an array.
+type headerValues []string
+
+func (v *headerValues) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*v = []string{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(v))
+}
+
+// readRequest reads the request file at path, or stdin if path is "-". An
+// empty path is a GET request to /.
+func readRequest(path string) (*http.Request, error) {
+	var data []byte
+	var err error
+	switch path {
+	case "":
+		data = []byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	case "-":
+		data, err = io.ReadAll(os.Stdin)
+	default:
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var req *http.Request
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		req, err = jsonRequest(trimmed)
+	} else {
+		req, err = http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if req.Host == "" {
+		req.Host = "localhost"
+	}
+	req.RemoteAddr = "127.0.0.1:0"
+	return req, nil
+}
+
+// jsonRequest builds a request from its JSON form.
+func jsonRequest(data []byte) (*http.Request, error) {
+	var f requestFile
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, err
+	}
+	if f.Method == "" {
+		f.Method = http.MethodGet
+	}
+	if f.URL == "" {
+		f.URL = "/"
+	}
+
+	body := []byte(f.Body)
+	if f.Base64 {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(f.Body); err != nil {
+			return nil, fmt.Errorf("invalid base64 body: %w", err)
+		}
+	}
+	req, err := http.NewRequest(f.Method, f.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.RequestURI = req.URL.RequestURI()
+	req.Host = f.Host
+	for k, v := range f.Headers {
+		req.Header[http.CanonicalHeaderKey(k)] = v
+	}
+	if h := req.Header.Get("Host"); h != "" && req.Host == "" {
+		req.Host = h
+	}
+	return req, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		method string
+		uri    string
+		host   string
+		header http.Header // Headers to check
+		body   string
+		err    string // Error reading the request, if any
+	}{
+		{"none", "", "GET", "/", "localhost", nil, "", ""},
+		{
+			"raw",
+			"POST /path?q=1 HTTP/1.1\r\nHost: example.com\r\nContent-Type: text/plain\r\nContent-Length: 5\r\n\r\nhello",
+			"POST", "/path?q=1", "example.com", http.Header{"Content-Type": {"text/plain"}}, "hello", "",
+		},
+		{"raw without host", "GET / HTTP/1.0\r\n\r\n", "GET", "/", "localhost", nil, "", ""},
+		{"raw malformed", "GET\r\n\r\n", "", "", "", nil, "", "malformed"},
+		{
+			"json",
+			`{"method": "POST", "url": "/path?q=1", "headers": {"content-type": "text/plain", "X-Test": ["a", "b"]}, "body": "hello"}`,
+			"POST", "/path?q=1", "localhost", http.Header{"Content-Type": {"text/plain"}, "X-Test": {"a", "b"}}, "hello", "",
+		},
+		{"json defaults", `{}`, "GET", "/", "localhost", nil, "", ""},
+		{"json host", `{"host": "example.com", "headers": {"Host": "other.com"}}`, "GET", "/", "example.com", nil, "", ""},
+		{"json host header", `{"headers": {"Host": "example.com"}}`, "GET", "/", "example.com", nil, "", ""},
+		{"json base64", `{"body": "AAH/", "base64": true}`, "GET", "/", "localhost", nil, "\x00\x01\xff", ""},
+		{"json invalid base64", `{"body": "hello!", "base64": true}`, "", "", "", nil, "", "invalid base64 body"},
+		{"json unknown field", `{"path": "/"}`, "", "", "", nil, "", "unknown field"},
+		{"json bad header", `{"headers": {"X-Test": 1}}`, "", "", "", nil, "", "cannot unmarshal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := ""
+			if tt.file != "" {
+				path = filepath.Join(t.TempDir(), "request")
+				if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			req, err := readRequest(path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("readRequest returned %v, want an error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if req.Method != tt.method || req.RequestURI != tt.uri || req.Host != tt.host {
+				t.Errorf("request is %s %s to %s, want %s %s to %s", req.Method, req.RequestURI, req.Host, tt.method, tt.uri, tt.host)
+			}
+			for k, want := range tt.header {
+				if got := req.Header.Values(k); !slices.Equal(got, want) {
+					t.Errorf("%s is %q, want %q", k, got, want)
+				}
+			}
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tt.body {
+				t.Errorf("body is %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestInvokeUsage(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"no module", nil, 2},
+		{"too many arguments", []string{"a.wasm", "req", "extra"}, 2},
+		{"unknown flag", []string{"-bogus", "a.wasm"}, 2},
+		{"unknown engine", []string{"-engine", "lua", "a.wasm"}, 2},
+		{"missing request", []string{"a.wasm", missing}, 2},
+		{"missing module", []string{missing + ".wasm"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := invoke(tt.args); code != tt.code {
+				t.Fatalf("invoke exited with %d, want %d", code, tt.code)
+			}
+		})
+	}
+}
+
+func TestInvokeFailingModule(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping module build in short mode")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command unavailable")
+	}
+	module := filepath.Join(t.TempDir(), "fail.wasm")
+	cmd := exec.Command(goBin, "build", "-o", module, "./internal/local/testdata/fail")
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to build the module: %v\n%s", err, b)
+	}
+
+	if code := invoke([]string{module}); code != 1 {
+		t.Fatalf("invoke exited with %d, want 1", code)
+	}
+}
@@ -1,8 +1,20 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
 	"github.com/ASparkOfFire/ignis/internal/cache"
+	"github.com/ASparkOfFire/ignis/internal/cron"
+	"github.com/ASparkOfFire/ignis/internal/deployment"
+	"github.com/ASparkOfFire/ignis/internal/protocol"
+	"github.com/ASparkOfFire/ignis/internal/queue"
 	"github.com/ASparkOfFire/ignis/internal/runtime"
 	"github.com/ASparkOfFire/ignis/internal/utils"
 	"github.com/gin-gonic/gin"
@@ -10,14 +22,182 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "invoke" {
+		os.Exit(invoke(os.Args[2:]))
+	}
+
+	cacheDir := flag.String("cache-dir", "", "directory for persistent compiled modules (in-memory if empty)")
+	cacheMaxBytes := flag.Int64("cache-max-bytes", 1<<30, "size budget of the compiled module directory")
+	cacheMaxEntries := flag.Int("cache-max-entries", 1000, "maximum number of compiled modules kept in memory")
+	cacheMaxCompiled := flag.Int64("cache-max-compiled", 512<<20, "size budget of compiled modules kept open, measured with -cache-dir and estimated from module sizes otherwise")
+	cacheTTL := flag.Duration("cache-ttl", time.Hour, "evict compiled modules unused for this long")
+	sharedCacheDir := flag.String("shared-cache-dir", "", "directory shared between nodes to exchange compiled modules (requires -cache-dir)")
+	debug := flag.Bool("debug", false, "include error details and guest stderr in error responses")
+	timeout := flag.Duration("timeout", time.Minute, "deadline of each invocation (none if zero)")
+	wasiHTTP := flag.String("wasi-http", "", "comma-separated deployments (go, js, grpc) to enable wasi-http for, serving modules that export an incoming handler through it")
+	grpcModule := flag.String("grpc-module", "", "WASM module hosting a gRPC server, which serves gRPC calls to any path")
+	h2c := flag.Bool("h2c", false, "accept HTTP/2 without TLS, which gRPC clients use (implied by -grpc-module)")
+	tlsCert := flag.String("tls-cert", "", "certificate file to serve HTTPS and HTTP/2 with (requires -tls-key)")
+	tlsKey := flag.String("tls-key", "", "private key file of -tls-cert")
+	cronHistoryDir := flag.String("cron-history-dir", "", "directory recording trigger runs, to catch up with runs missed while down (in-memory if empty)")
+	cronHistory := flag.Int("cron-history", 100, "number of runs kept per trigger")
+	queueDir := flag.String("queue-dir", "", "directory persisting queued messages (in-memory if empty)")
+	queueToken := flag.String("queue-token", "", "bearer token required to enqueue messages over HTTP (disabled if empty)")
+	flag.Parse()
+
+	// wasi configures the WASI of the deployment named name.
+	wasi := func(name string) *runtime.WasiConfig {
+		enabled := slices.Contains(strings.Split(*wasiHTTP, ","), name)
+		return &runtime.WasiConfig{MaxOpenFiles: 1024, EnableHttp: enabled}
+	}
+
 	r := gin.Default()
-	modCache := cache.NewModCache[uuid.UUID]()
-	id := uuid.MustParse("006e267f-b578-43ba-a844-7c34aa2bf00a")
-	idJs := uuid.MustParse("006e267f-b578-43ba-a844-7c34aa2bf00b")
+	r.UseH2C = *h2c || *grpcModule != ""
+	cacheOpts := cache.Options{
+		MaxEntries: *cacheMaxEntries,
+		MaxBytes:   *cacheMaxCompiled,
+		TTL:        *cacheTTL,
+	}
+	local := cache.NewModCache[cache.Digest](cacheOpts)
+	modCache := &local
+	var cacher cache.Cacher[cache.Digest] = modCache
+	if *cacheDir != "" {
+		dirCache, err := cache.NewDirCache(*cacheDir, *cacheMaxBytes)
+		if err != nil {
+			log.Fatalf("Failed to open cache directory: %v", err)
+		}
+		go pruneLoop(dirCache, 10*time.Minute)
+
+		if *sharedCacheDir != "" {
+			store, err := cache.NewDirStore(*sharedCacheDir)
+			if err != nil {
+				log.Fatalf("Failed to open shared cache directory: %v", err)
+			}
+			shared := cache.NewSharedCache[cache.Digest](dirCache, store, cacheOpts)
+			modCache, cacher = shared.ModCache, shared
+		} else {
+			local = cache.NewDirModCache[cache.Digest](dirCache, cacheOpts)
+		}
+	}
+	go sweepLoop(modCache, time.Minute)
+	registry := deployment.NewRegistry(cacher)
+
+	broker := queue.NewBroker(*queueDir)
+	if _, err := broker.Declare("jobs", queue.Options{VisibilityTimeout: *timeout + 10*time.Second}); err != nil {
+		log.Fatalf("Failed to declare queue: %v", err)
+	}
+	host := &runtime.Host{Enqueue: broker.Enqueue}
+
+	goDeployment, err := registry.Register(context.Background(), deployment.Spec{
+		ID:      uuid.MustParse("006e267f-b578-43ba-a844-7c34aa2bf00a"),
+		Path:    "./example/go/example.wasm",
+		Engine:  runtime.RuntimeEngineWASM,
+		Debug:   *debug,
+		Timeout: *timeout,
+		Wasi:    wasi("go"),
+		Cron: []cron.Trigger{{
+			Name:     "heartbeat",
+			Schedule: "*/5 * * * *",
+			Path:     "/api/v1/heartbeat",
+			Data:     []byte(`{"source":"cron"}`),
+			Jitter:   10 * time.Second,
+		}},
+		Queues:   []queue.Subscription{{Queue: "jobs", Path: "/api/v1/jobs"}},
+		Produces: []string{"jobs"},
+		Host:     host,
+	})
+	if err != nil {
+		log.Fatalf("Failed to register deployment: %v", err)
+	}
+	jsDeployment, err := registry.Register(context.Background(), deployment.Spec{
+		ID:       uuid.MustParse("006e267f-b578-43ba-a844-7c34aa2bf00b"),
+		Path:     "./example/js/dist/example.js",
+		Engine:   runtime.RuntimeEngineJS,
+		Encoding: protocol.EncodingJSON,
+		Debug:    *debug,
+		Timeout:  *timeout,
+		Wasi:     wasi("js"),
+	})
+	if err != nil {
+		log.Fatalf("Failed to register deployment: %v", err)
+	}
+
+	r.Any("/api/v1/*any", utils.WASIWrapper(goDeployment, cacher))
+	r.Any("/js", utils.WASIWrapper(jsDeployment, cacher))
 
-	r.Any("/api/v1/*any", utils.WASIWrapper("./example/go/example.wasm", modCache, runtime.RuntimeEngineWASM, id))
-	r.Any("/js", utils.WASIWrapper("./example/js/dist/example.js", modCache, runtime.RuntimeEngineJS, idJs))
+	if *grpcModule != "" {
+		grpcDeployment, err := registry.Register(context.Background(), deployment.Spec{
+			ID:      uuid.MustParse("006e267f-b578-43ba-a844-7c34aa2bf00c"),
+			Path:    *grpcModule,
+			Engine:  runtime.RuntimeEngineWASM,
+			Debug:   *debug,
+			Timeout: *timeout,
+			Wasi:    wasi("grpc"),
+		})
+		if err != nil {
+			log.Fatalf("Failed to register deployment: %v", err)
+		}
+		// gRPC methods are served at /<package>.<Service>/<Method>.
+		r.NoRoute(utils.GRPCWrapper(grpcDeployment, cacher))
+	}
+
+	r.GET("/_ignis/deployments", utils.ListDeployments(registry))
+	r.GET("/_ignis/deployments/:id", utils.GetDeployment(registry))
+	r.GET("/_ignis/cache", utils.CacheStats(modCache))
+
+	history, err := cron.NewHistory(*cronHistoryDir, *cronHistory)
+	if err != nil {
+		log.Fatalf("Failed to open trigger history: %v", err)
+	}
+	scheduler := cron.NewScheduler(history)
+	for _, d := range registry.List() {
+		for _, t := range d.Cron {
+			if err := scheduler.Add(d.ID.String()+"/"+t.Name, t, utils.TriggerHandler(d, cacher)); err != nil {
+				log.Fatalf("Failed to schedule trigger: %v", err)
+			}
+		}
+	}
+	scheduler.Start(context.Background())
+	r.GET("/_ignis/cron", utils.CronStatus(scheduler))
+
+	for _, d := range registry.List() {
+		for _, s := range d.Queues {
+			q, ok := broker.Get(s.Queue)
+			if !ok {
+				log.Fatalf("Deployment %s subscribes to unknown queue %s", d.ID, s.Queue)
+			}
+			go queue.Consume(context.Background(), q, s, utils.TriggerHandler(d, cacher))
+		}
+	}
+	r.GET("/_ignis/queues", utils.ListQueues(broker))
+	if *queueToken != "" {
+		r.POST("/_ignis/queues/:name/messages", utils.EnqueueMessage(broker, *queueToken))
+	}
 
 	fmt.Println("Listening on 6969")
-	r.Run(":6969")
+	if *tlsCert != "" {
+		err = r.RunTLS(":6969", *tlsCert, *tlsKey)
+	} else {
+		err = r.Run(":6969")
+	}
+	if err != nil {
+		log.Fatalf("Failed to serve: %v", err)
+	}
+}
+
+// pruneLoop prunes the compiled module directory now and on every interval.
+func pruneLoop(dirCache *cache.DirCache, interval time.Duration) {
+	for {
+		if err := dirCache.Prune(); err != nil {
+			log.Printf("Failed to prune cache directory: %v\n", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// sweepLoop evicts idle compiled modules on every interval.
+func sweepLoop(modCache *cache.ModCache[cache.Digest], interval time.Duration) {
+	for range time.Tick(interval) {
+		modCache.Sweep()
+	}
 }
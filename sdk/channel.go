@@ -0,0 +1,25 @@
+package sdk
+
+import "io"
+
+// responseChannel writes the response with the ignis.response_write host
+// call, so that the guest's stdout is free for logs. Hosts that provide no
+// response channel read the response from stdout instead.
+type responseChannel struct {
+	stdout      io.Writer
+	unavailable bool // The host provides no channel; write to stdout
+}
+
+func (c *responseChannel) Write(p []byte) (int, error) {
+	if !c.unavailable {
+		switch result := responseWrite(p); result {
+		case hostOK:
+			return len(p), nil
+		case hostUnavailable:
+			c.unavailable = true
+		default:
+			return 0, hostError("response_write", result)
+		}
+	}
+	return c.stdout.Write(p)
+}
@@ -0,0 +1,121 @@
+//go:build !wasip1
+
+package sdk
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	types "github.com/ASparkOfFire/ignis/internal/proto"
+	"github.com/ASparkOfFire/ignis/internal/protocol"
+	"github.com/google/uuid"
+)
+
+// DevAddrEnv sets the address the development server listens on.
+const DevAddrEnv = "IGNIS_DEV_ADDR"
+
+// defaultDevAddr is where the development server listens without DevAddrEnv.
+const defaultDevAddr = "localhost:8080"
+
+// Handle serves a single request read from stdin, if not nil. Otherwise there
+// is no host outside of a wasip1 guest, so Handle runs a development server
+// on DevAddrEnv, localhost:8080 by default, until it fails. Each request goes
+// through the protocol as with Ignis, so h sees the same requests, and the
+// response is sent the same way, with guest errors as problem details.
+func Handle(h http.Handler, stdin io.Reader) {
+	if stdin != nil {
+		handle(h, stdin, os.Stdout, false)
+		return
+	}
+
+	enc, err := protocol.ParseEncoding(os.Getenv(protocol.EncodingEnv))
+	if err != nil {
+		log.Fatal(err)
+	}
+	addr := os.Getenv(DevAddrEnv)
+	if addr == "" {
+		addr = defaultDevAddr
+	}
+	log.Printf("Serving on http://%s\n", addr)
+	log.Fatal(http.ListenAndServe(addr, devHandler(h, enc)))
+}
+
+// devHandler returns an http.Handler serving each request with h like a
+// guest would: the request is encoded with enc as the host encodes it, and
+// decoded by the SDK, as is the response.
+func devHandler(h http.Handler, enc protocol.Encoding) http.Handler {
+	deploymentID := uuid.New()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inv := protocol.NewInvocation(deploymentID, r, 0)
+		stdin, stdinW := io.Pipe()
+		stdout, stdoutW := io.Pipe()
+
+		reqDone := make(chan struct{})
+		go func() {
+			defer close(reqDone)
+			stdinW.CloseWithError(protocol.WriteRequest(stdinW, r, inv, protocol.MaxVersion, enc))
+		}()
+		served := make(chan struct{})
+		go func() {
+			defer close(served)
+			err := serveRequest(h, stdin, stdoutW, enc, false)
+			stdin.Close() // Unblock the request writer if h did not read the body
+			stdoutW.CloseWithError(err)
+		}()
+
+		// The request body must not be touched once the handler returns.
+		defer func() {
+			stdout.Close()
+			<-served
+			<-reqDone
+		}()
+
+		resp, err := protocol.ReadResponse(stdout, enc)
+		if err != nil {
+			log.Printf("Failed to read response: invocation %s: %v\n", inv.ID, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if resp.Head.Error != nil {
+			writeProblem(w, resp.Head)
+			return
+		}
+		if resp.Head.StatusCode == http.StatusSwitchingProtocols {
+			http.Error(w, "WebSockets are not supported by the development server", http.StatusNotImplemented)
+			return
+		}
+		writeDevResponse(w, resp)
+	})
+}
+
+// writeDevResponse sends resp as the host does, streaming its body and
+// forwarding flushes.
+func writeDevResponse(w http.ResponseWriter, resp *protocol.Response) {
+	if err := protocol.ValidateResponse(resp.Head); err != nil {
+		log.Printf("Invalid response: %v\n", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	protocol.WriteResponseHeader(w, resp.Head)
+	if resp.Stream != nil {
+		rc := http.NewResponseController(w)
+		resp.Stream.OnFlush(func() { rc.Flush() })
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		log.Printf("Failed to stream response: %v\n", err)
+		return
+	}
+	protocol.WriteResponseTrailer(w, resp.Trailer)
+}
+
+// writeProblem answers with the structured error of head as problem details,
+// as the host does.
+func writeProblem(w http.ResponseWriter, head *types.FDResponse) {
+	p := protocol.GuestProblem(head)
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
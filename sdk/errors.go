@@ -0,0 +1,92 @@
+package sdk
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime/debug"
+
+	types "github.com/ASparkOfFire/ignis/internal/proto"
+)
+
+// Error is a structured error reported to the host, which answers the client
+// with an application/problem+json response built from it.
+type Error struct {
+	Code      string            // Machine-readable error code
+	Message   string            // Human-readable description of this occurrence
+	Details   map[string]string // Additional context
+	Retryable bool              // Whether the client may retry the request
+	Status    int               // HTTP status of the response, 500 if zero
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// HandlerFunc is an http.Handler that may fail. A returned error is reported
+// to the host with Fail.
+type HandlerFunc func(http.ResponseWriter, *http.Request) error
+
+func (f HandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := f(w, r); err != nil {
+		Fail(w, err)
+	}
+}
+
+// Fail reports err to the host in place of the response. An *Error in err's
+// chain is sent as is; other errors are reported with the "internal" code.
+// If the response is already streaming, the error ends it instead.
+func Fail(w http.ResponseWriter, err error) {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = &Error{Code: "internal", Message: err.Error()}
+	}
+
+	resp, ok := responseOf(w)
+	if !ok {
+		status := e.Status
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		http.Error(w, e.Error(), status)
+		return
+	}
+	resp.fail(e)
+}
+
+// serve runs h, reporting a panic as an Error. The stack goes to stderr,
+// which the host includes in error responses in debug mode. As with
+// net/http, panicking with http.ErrAbortHandler aborts the response without
+// logging a stack.
+func serve(h http.Handler, w *Response, r *http.Request) {
+	defer func() {
+		v := recover()
+		switch {
+		case v == nil:
+			return
+		case v == http.ErrAbortHandler:
+			w.fail(&Error{Code: "aborted", Message: "handler aborted the response"})
+		default:
+			fmt.Fprintf(os.Stderr, "panic: %v\n\n%s", v, debug.Stack())
+			w.fail(&Error{Code: "panic", Message: fmt.Sprint(v)})
+		}
+	}()
+	h.ServeHTTP(w, r)
+}
+
+// toProto converts e to its protocol form. A nil Error converts to nil.
+func (e *Error) toProto() *types.Error {
+	if e == nil {
+		return nil
+	}
+	return &types.Error{
+		Code:      e.Code,
+		Message:   e.Message,
+		Details:   e.Details,
+		Retryable: e.Retryable,
+	}
+}
@@ -0,0 +1,26 @@
+//go:build wasip1
+
+package sdk
+
+import (
+	"io"
+	"net/http"
+	"os"
+)
+
+// Handle serves a single request read from stdin, or if nil with the host's
+// request functions or from os.Stdin. The response goes through the host's
+// response channel, or to stdout if it provides none, so that handlers may
+// print to stdout to log.
+//
+// The host's request functions and response channel are only used by modules
+// built with the ignis_hostio tag, which then require the ignis host module
+// and only run on Ignis.
+func Handle(h http.Handler, stdin io.Reader) {
+	hostRequest := stdin == nil
+	if stdin == nil {
+		stdin = os.Stdin
+	}
+
+	handle(h, stdin, &responseChannel{stdout: os.Stdout}, hostRequest)
+}
@@ -0,0 +1,9 @@
+//go:build !wasip1
+
+package sdk
+
+// Host calls are only available to guests.
+
+func queueEnqueue(string, []byte) uint32 {
+	return hostUnavailable
+}
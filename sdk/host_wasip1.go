@@ -0,0 +1,12 @@
+//go:build wasip1
+
+package sdk
+
+import "unsafe"
+
+//go:wasmimport ignis queue_enqueue
+func hostQueueEnqueue(queuePtr unsafe.Pointer, queueLen uint32, bodyPtr unsafe.Pointer, bodyLen uint32) uint32
+
+func queueEnqueue(queue string, body []byte) uint32 {
+	return hostQueueEnqueue(unsafe.Pointer(unsafe.StringData(queue)), uint32(len(queue)), unsafe.Pointer(unsafe.SliceData(body)), uint32(len(body)))
+}
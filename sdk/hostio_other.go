@@ -0,0 +1,24 @@
+//go:build !wasip1 || !ignis_hostio
+
+package sdk
+
+// hostIO reports whether the request and response host calls are linked in.
+// Without the ignis_hostio build tag, requests are read from stdin and
+// responses written to stdout.
+const hostIO = false
+
+func responseWrite([]byte) uint32 {
+	return hostUnavailable
+}
+
+func requestHead([]byte, *uint32) uint32 {
+	return hostUnavailable
+}
+
+func requestRead([]byte, *uint32) uint32 {
+	return hostUnavailable
+}
+
+func requestTrailers([]byte, *uint32) uint32 {
+	return hostUnavailable
+}
@@ -0,0 +1,38 @@
+//go:build wasip1 && ignis_hostio
+
+package sdk
+
+import "unsafe"
+
+// hostIO reports whether the request and response host calls are linked in.
+// Modules importing them only instantiate on hosts providing the ignis host
+// module, so they are opted into with the ignis_hostio build tag.
+const hostIO = true
+
+//go:wasmimport ignis response_write
+func hostResponseWrite(ptr unsafe.Pointer, length uint32) uint32
+
+func responseWrite(b []byte) uint32 {
+	return hostResponseWrite(unsafe.Pointer(unsafe.SliceData(b)), uint32(len(b)))
+}
+
+//go:wasmimport ignis request_head
+func hostRequestHead(ptr unsafe.Pointer, capacity uint32, sizePtr unsafe.Pointer) uint32
+
+func requestHead(buf []byte, size *uint32) uint32 {
+	return hostRequestHead(unsafe.Pointer(unsafe.SliceData(buf)), uint32(len(buf)), unsafe.Pointer(size))
+}
+
+//go:wasmimport ignis request_read
+func hostRequestRead(ptr unsafe.Pointer, capacity uint32, nPtr unsafe.Pointer) uint32
+
+func requestRead(buf []byte, n *uint32) uint32 {
+	return hostRequestRead(unsafe.Pointer(unsafe.SliceData(buf)), uint32(len(buf)), unsafe.Pointer(n))
+}
+
+//go:wasmimport ignis request_trailers
+func hostRequestTrailers(ptr unsafe.Pointer, capacity uint32, sizePtr unsafe.Pointer) uint32
+
+func requestTrailers(buf []byte, size *uint32) uint32 {
+	return hostRequestTrailers(unsafe.Pointer(unsafe.SliceData(buf)), uint32(len(buf)), unsafe.Pointer(size))
+}
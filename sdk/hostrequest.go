@@ -0,0 +1,110 @@
+package sdk
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	types "github.com/ASparkOfFire/ignis/internal/proto"
+	"github.com/ASparkOfFire/ignis/internal/protocol"
+)
+
+// hostBuffer is the initial size of buffers filled by host calls.
+const hostBuffer = 4 << 10
+
+// readHostRequestHead reads the head of the request with the
+// ignis.request_head host call. It fails with ErrHostUnavailable if the host
+// sent the request on stdin instead.
+func readHostRequestHead() ([]byte, error) {
+	return readSized("request_head", requestHead)
+}
+
+// readSized calls the host call fn, which fills buf and stores the size of
+// its result, with a larger buffer until the result fits.
+func readSized(fn string, call func(buf []byte, size *uint32) uint32) ([]byte, error) {
+	buf := make([]byte, hostBuffer)
+	for {
+		var size uint32
+		if err := hostError(fn, call(buf, &size)); err != nil {
+			return nil, err
+		}
+		if int(size) <= len(buf) {
+			return buf[:size], nil
+		}
+		buf = make([]byte, size)
+	}
+}
+
+// handleHostRequest serves a request whose head was read with a host call,
+// failing with headErr, and whose body is read with host calls, straight into
+// the handler's buffers. The response is streamed as for framed requests.
+func handleHostRequest(h http.Handler, head []byte, headErr error, stdout io.Writer, enc protocol.Encoding) error {
+	w := NewFDResponse()
+	w.stream = protocol.NewWriter(stdout, enc)
+	w.version = protocol.Version2 // Only Version2 requests are read with host calls
+
+	var req types.FDRequest
+	if headErr != nil {
+		w.fail(badRequest(fmt.Errorf("failed to read request: %w", headErr)))
+		return w.finish()
+	}
+	if err := enc.Unmarshal(head, &req); err != nil {
+		w.fail(badRequest(fmt.Errorf("failed to decode request: %w", err)))
+		return w.finish()
+	}
+	w.version = req.Version
+	w.capabilities = req.Capabilities & protocol.Capabilities
+
+	trailer := http.Header{}
+	r, cancel, err := newRequest(&req, &hostBody{trailer: trailer, enc: enc})
+	if err != nil {
+		w.fail(badRequest(err))
+		return w.finish()
+	}
+	defer cancel()
+	r.Trailer = trailer
+
+	w.cancel = cancel
+	serve(h, w, r) // execute the user's handler
+	return w.finish()
+}
+
+// hostBody is a request body read with the ignis.request_read host call.
+// Once it is read, the trailers are added to trailer.
+type hostBody struct {
+	trailer http.Header
+	enc     protocol.Encoding
+	err     error // Returned once the body is read, or failed
+}
+
+func (b *hostBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	var n uint32
+	if b.err = hostError("request_read", requestRead(p, &n)); b.err != nil {
+		return 0, b.err
+	}
+	if n > 0 {
+		return int(n), nil
+	}
+
+	b.err = io.EOF
+	data, err := readSized("request_trailers", requestTrailers)
+	if err != nil {
+		b.err = err
+		return 0, err
+	}
+	var trailers types.Trailers
+	if err := b.enc.Unmarshal(data, &trailers); err != nil {
+		b.err = fmt.Errorf("failed to decode trailers: %w", err)
+		return 0, b.err
+	}
+	for k, v := range protocol.ToHeader(trailers.Header) {
+		b.trailer[k] = v
+	}
+	return 0, io.EOF
+}
@@ -0,0 +1,70 @@
+package sdk
+
+import (
+	"context"
+	"time"
+
+	types "github.com/ASparkOfFire/ignis/internal/proto"
+)
+
+// Invocation is the metadata the host sends with a request.
+type Invocation struct {
+	DeploymentID string
+	ID           string
+	Deadline     time.Time // Zero without deadline; r.Context() expires then too
+	Traceparent  string    // W3C trace context of the host's span, also in the Traceparent header
+	Tracestate   string
+	Event        *Event // What triggered the request, nil if a client made it
+}
+
+// Event describes what triggered a request no client made, such as a cron
+// schedule. Its Data is also the request's body.
+type Event struct {
+	ID         string
+	Type       string // Kind of trigger, such as "ignis.cron"
+	Source     string // Name of the trigger
+	Time       time.Time
+	Data       []byte
+	Attributes map[string]string
+}
+
+type invocationKey struct{}
+
+// InvocationFromContext returns the invocation of the request whose context is ctx.
+func InvocationFromContext(ctx context.Context) (*Invocation, bool) {
+	inv, ok := ctx.Value(invocationKey{}).(*Invocation)
+	return inv, ok
+}
+
+// newInvocation reads the invocation metadata of req.
+func newInvocation(req *types.FDRequest) *Invocation {
+	inv := &Invocation{
+		DeploymentID: req.DeploymentID,
+		ID:           req.InvocationID,
+		Traceparent:  req.Traceparent,
+		Tracestate:   req.Tracestate,
+	}
+	if req.Deadline != 0 {
+		inv.Deadline = time.UnixMilli(req.Deadline)
+	}
+	if e := req.Event; e != nil {
+		inv.Event = &Event{
+			ID:         e.ID,
+			Type:       e.Type,
+			Source:     e.Source,
+			Time:       time.UnixMilli(e.Time),
+			Data:       e.Data,
+			Attributes: e.Attributes,
+		}
+	}
+	return inv
+}
+
+// context returns a context carrying inv and expiring at its deadline.
+func (inv *Invocation) context() (context.Context, context.CancelFunc) {
+	ctx := context.WithValue(context.Background(), invocationKey{}, inv)
+	if inv.Deadline.IsZero() {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, inv.Deadline)
+}
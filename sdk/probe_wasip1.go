@@ -0,0 +1,14 @@
+//go:build wasip1
+
+package sdk
+
+import "github.com/ASparkOfFire/ignis/internal/protocol"
+
+// protocolExport is exported as protocol.ProbeExport, telling the host that
+// modules built with this SDK answer protocol probes instead of serving them.
+// It returns the highest protocol version spoken.
+//
+//go:wasmexport ignis_protocol
+func protocolExport() uint32 {
+	return protocol.MaxVersion
+}
@@ -0,0 +1,38 @@
+package sdk
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrHostUnavailable is returned by host calls the host does not provide,
+// such as when running outside of Ignis.
+var ErrHostUnavailable = errors.New("host call unavailable")
+
+// Results of host calls, as defined by the ignis host module.
+const (
+	hostOK uint32 = iota
+	hostInvalid
+	hostFailed
+	hostUnavailable
+)
+
+// Enqueue adds body as a message to the queue named queue. Deployments
+// subscribed to it are invoked with the message asynchronously.
+func Enqueue(queue string, body []byte) error {
+	return hostError("queue_enqueue", queueEnqueue(queue, body))
+}
+
+// hostError converts the result of the host call fn to an error.
+func hostError(fn string, result uint32) error {
+	switch result {
+	case hostOK:
+		return nil
+	case hostUnavailable:
+		return ErrHostUnavailable
+	case hostInvalid:
+		return fmt.Errorf("%s: invalid arguments", fn)
+	default:
+		return fmt.Errorf("%s failed", fn)
+	}
+}
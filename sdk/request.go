@@ -0,0 +1,91 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	types "github.com/ASparkOfFire/ignis/internal/proto"
+)
+
+// newRequest rebuilds the *http.Request the host received from its FDRequest,
+// the way net/http would present it to a server handler. A nil body means it
+// was sent inline in req. The request's context carries the invocation and
+// its deadline, and is released by the returned func.
+func newRequest(req *types.FDRequest, body io.Reader) (*http.Request, context.CancelFunc, error) {
+	u, err := url.ParseRequestURI(req.RequestURI)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid request URI %q: %w", req.RequestURI, err)
+	}
+	if u.Host == "" {
+		u.Host = req.Host
+		u.Scheme = req.Scheme
+		if u.Scheme == "" {
+			u.Scheme = "http"
+		}
+	}
+
+	if body == nil {
+		body = bytes.NewReader(req.Body)
+	}
+	inv := newInvocation(req)
+	ctx, cancel := inv.context()
+	r, err := http.NewRequestWithContext(ctx, req.Method, u.String(), body)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	// Cookies are parsed from the Cookie header on demand by r.Cookies.
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r.Header[k] = v.GetFields()
+	}
+	if inv.Traceparent != "" {
+		r.Header.Set("Traceparent", inv.Traceparent)
+		r.Header.Del("Tracestate")
+		if inv.Tracestate != "" {
+			r.Header.Set("Tracestate", inv.Tracestate)
+		}
+	}
+
+	r.Host = req.Host
+	r.RemoteAddr = req.RemoteAddr
+	r.RequestURI = req.RequestURI
+	r.ContentLength = req.ContentLength
+	r.TransferEncoding = req.TransferEncoding.GetFields()
+
+	r.Proto, r.ProtoMajor, r.ProtoMinor = req.Proto, int(req.ProtoMajor), int(req.ProtoMinor)
+	if r.Proto == "" {
+		r.Proto, r.ProtoMajor, r.ProtoMinor = "HTTP/1.1", 1, 1
+	}
+	r.TLS = connectionState(req.TLS)
+
+	return r, cancel, nil
+}
+
+// connectionState rebuilds the TLS state of the client connection. Peer
+// certificates that fail to parse are left out.
+func connectionState(info *types.TLSInfo) *tls.ConnectionState {
+	if info == nil {
+		return nil
+	}
+	state := &tls.ConnectionState{
+		Version:            uint16(info.Version),
+		HandshakeComplete:  true,
+		CipherSuite:        uint16(info.CipherSuite),
+		NegotiatedProtocol: info.NegotiatedProtocol,
+		ServerName:         info.ServerName,
+	}
+	for _, der := range info.PeerCertificates {
+		if cert, err := x509.ParseCertificate(der); err == nil {
+			state.PeerCertificates = append(state.PeerCertificates, cert)
+		}
+	}
+	return state
+}
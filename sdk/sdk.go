@@ -1,23 +1,41 @@
 package sdk
 
 import (
-	"bytes"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 
 	types "github.com/ASparkOfFire/ignis/internal/proto"
+	"github.com/ASparkOfFire/ignis/internal/protocol"
 	_ "github.com/breml/rootcerts"
 	_ "github.com/ignis-runtime/net/http"
 	"google.golang.org/protobuf/proto"
 )
 
+// Response is the http.ResponseWriter passed to handlers. When the host
+// streams, the body is sent in frames as it is written instead of in Body,
+// followed by the trailers. Trailers are set as with net/http.
 type Response struct {
 	Headers    http.Header
 	Body       []byte
 	StatusCode int
 	Length     int
+
+	stream       *protocol.Writer
+	frames       *protocol.Reader   // The request stream, which carries WebSocket messages after an upgrade
+	buf          []byte             // Body written since the last flush
+	cancel       context.CancelFunc // Cancels the request's context once the host stops reading
+	conn         *Conn              // Set once upgraded to a WebSocket
+	wroteHeader  bool
+	err          *Error // Reported in place of the response, or in its trailers once streaming
+	version      uint32 // Protocol version of the request, echoed back
+	capabilities uint64 // Capabilities shared with the host
 }
 
 func NewFDResponse() *Response {
@@ -27,55 +45,164 @@ func NewFDResponse() *Response {
 	}
 }
 
-func Handle(h http.Handler, stdin io.Reader) {
-	// If no stdin provided, use os.Stdin as fallback
-	if stdin == nil {
-		stdin = os.Stdin
+// HandleWithIO serves a single request read from stdin and writes the
+// response to stdout, streaming both if the host sent a framed request. A
+// streamed response is sent in chunks, or as soon as the handler flushes it.
+//
+// A request that cannot be decoded is answered with a 400 and a handler that
+// panics with a 500, both carrying an Error. The process exits with a code
+// other than protocol.ExitOK only if no response could be written.
+func HandleWithIO(h http.Handler, stdin io.Reader, stdout io.Writer) {
+	handle(h, stdin, stdout, false)
+}
+
+// handle implements Handle and HandleWithIO. With hostRequest, the request is
+// read with the host's request functions if it provides them.
+func handle(h http.Handler, stdin io.Reader, stdout io.Writer, hostRequest bool) {
+	if os.Getenv(protocol.ProbeEnv) != "" {
+		if err := writeProbe(stdout, capabilities(stdout, hostRequest)); err != nil {
+			exit(protocol.ExitWriteFailed, fmt.Errorf("failed to write probe response: %w", err))
+		}
+		return
 	}
 
-	HandleWithIO(h, stdin, os.Stdout)
+	enc, err := protocol.ParseEncoding(os.Getenv(protocol.EncodingEnv))
+	if err != nil {
+		exit(protocol.ExitUnsupported, err)
+	}
+	if err := serveRequest(h, stdin, stdout, enc, hostRequest); err != nil {
+		exit(protocol.ExitWriteFailed, fmt.Errorf("failed to write response: %w", err))
+	}
 }
 
-func HandleWithIO(h http.Handler, stdin io.Reader, stdout io.Writer) {
-	b, err := io.ReadAll(stdin)
+// serveRequest serves a single request encoded with enc, and returns an
+// error only if the response could not be written.
+func serveRequest(h http.Handler, stdin io.Reader, stdout io.Writer, enc protocol.Encoding, hostRequest bool) error {
+	var head []byte
+	var err error
+	if hostRequest {
+		head, err = readHostRequestHead()
+	}
+	if hostRequest && !errors.Is(err, ErrHostUnavailable) {
+		return handleHostRequest(h, head, err, stdout, enc)
+	}
+	in := bufio.NewReaderSize(stdin, protocol.MaxChunk)
+	if protocol.IsFramed(in) {
+		return handleFramed(h, in, stdout, enc)
+	}
+	return handleBuffered(h, in, stdout, enc)
+}
+
+// exit reports err on stderr, which the host logs, and exits with code.
+func exit(code uint32, err error) {
+	fmt.Fprintf(os.Stderr, "ignis: %v\n", err)
+	os.Exit(int(code))
+}
+
+// badRequest is the Error answering a request that cannot be decoded.
+func badRequest(err error) *Error {
+	return &Error{Code: "bad_request", Message: err.Error(), Status: http.StatusBadRequest}
+}
+
+// capabilities returns the capabilities of this SDK that a guest writing its
+// response to stdout, and reading its request with host calls if hostRequest,
+// uses. The host calls are only linked in with the ignis_hostio build tag.
+func capabilities(stdout io.Writer, hostRequest bool) uint64 {
+	caps := protocol.Capabilities &^ (protocol.CapResponseChannel | protocol.CapHostRequest)
+	if _, ok := stdout.(*responseChannel); ok && hostIO {
+		caps |= protocol.CapResponseChannel
+	}
+	if hostRequest && hostIO {
+		caps |= protocol.CapHostRequest
+	}
+	return caps
+}
+
+// writeProbe answers a protocol probe with the versions of this SDK and caps.
+// The answer is always protobuf, which every host can decode.
+func writeProbe(stdout io.Writer, caps uint64) error {
+	b, err := proto.Marshal(&types.FDResponse{
+		MinVersion:   protocol.MinVersion,
+		Version:      protocol.MaxVersion,
+		Capabilities: caps,
+	})
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	_, err = stdout.Write(b)
+	return err
+}
+
+// handleFramed serves a request sent in frames, and streams the response.
+func handleFramed(h http.Handler, in *bufio.Reader, stdout io.Writer, enc protocol.Encoding) error {
+	fr := protocol.NewReader(in, enc)
 	w := NewFDResponse()
+	w.stream = protocol.NewWriter(stdout, enc)
+	w.frames = fr
+	w.version = protocol.Version2 // Only Version2 requests are framed
 
 	var req types.FDRequest
-	if err := proto.Unmarshal(b, &req); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		return
+	if err := fr.ReadMessage(protocol.FrameHeaders, &req); err != nil {
+		w.fail(badRequest(fmt.Errorf("failed to decode request: %w", err)))
+		return w.finish()
 	}
+	w.version = req.Version
+	w.capabilities = req.Capabilities & protocol.Capabilities
 
-	r, err := http.NewRequest(req.Method, req.RequestURI, bytes.NewReader(req.Body))
+	trailer := http.Header{}
+	r, cancel, err := newRequest(&req, fr.Body(trailer, 0))
 	if err != nil {
-		log.Fatal(err)
+		w.fail(badRequest(err))
+		return w.finish()
 	}
+	defer cancel()
+	r.Trailer = trailer
 
-	h.ServeHTTP(w, r) // execute the user's handler
+	w.cancel = cancel
+	serve(h, w, r) // execute the user's handler
+	return w.finish()
+}
+
+// handleBuffered serves a request sent as a single FDRequest message and
+// answers with a single FDResponse message, both encoded with enc.
+func handleBuffered(h http.Handler, stdin io.Reader, stdout io.Writer, enc protocol.Encoding) error {
+	w := NewFDResponse()
+	var req types.FDRequest
+	b, err := io.ReadAll(stdin)
+	if err != nil {
+		w.fail(badRequest(fmt.Errorf("failed to read request: %w", err)))
+	} else if err := enc.Unmarshal(b, &req); err != nil {
+		w.fail(badRequest(fmt.Errorf("failed to decode request: %w", err)))
+	} else if r, cancel, err := newRequest(&req, nil); err != nil {
+		w.fail(badRequest(err))
+	} else {
+		defer cancel()
+		serve(h, w, r) // execute the user's handler
+	}
 	w.Length = len(w.Body)
-	protoResp := types.FDResponse{
-		Body:       w.Body,
-		StatusCode: int32(w.StatusCode),
-		Length:     int32(w.Length),
-		Header:     make(map[string]*types.HeaderFields),
+
+	// Without frames there are no trailers, so they are sent as headers.
+	header := w.header()
+	for k, v := range w.trailers() {
+		header[k] = v
 	}
-	for k, v := range w.Headers {
-		protoResp.Header[k] = &types.HeaderFields{Fields: v}
+	header.Del("Trailer")
+	protoResp := types.FDResponse{
+		Body:         w.Body,
+		StatusCode:   int32(w.StatusCode),
+		Length:       int32(w.Length),
+		Header:       protocol.FromHeader(header),
+		Version:      req.Version,
+		Capabilities: req.Capabilities & protocol.Capabilities,
+		Error:        w.err.toProto(),
 	}
 
-	b, err = proto.Marshal(&protoResp)
+	b, err = enc.Marshal(&protoResp)
 	if err != nil {
-		log.Printf("Error encoding response: %s", err)
-	}
-
-	// Write to provided stdout
-	n, err := stdout.Write(b)
-	if err != nil || n != len(b) {
-		log.Printf("Error writing response: %s, bytes written: %d", err, n)
+		return fmt.Errorf("failed to encode response: %w", err)
 	}
+	_, err = stdout.Write(b)
+	return err
 }
 
 func (w *Response) Header() http.Header {
@@ -83,10 +210,178 @@ func (w *Response) Header() http.Header {
 }
 
 func (w *Response) Write(b []byte) (n int, err error) {
-	w.Body = append(w.Body, b...) // Store as []byte
+	if w.conn != nil {
+		return 0, http.ErrHijacked
+	}
+	if w.err != nil && !w.wroteHeader {
+		return len(b), nil // The host answers with the error instead
+	}
+	if w.stream == nil {
+		w.Body = append(w.Body, b...) // Store as []byte
+		return len(b), nil
+	}
+
+	w.Length += len(b)
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= protocol.MaxChunk {
+		if err := w.flushBody(); err != nil {
+			return 0, err
+		}
+	}
 	return len(b), nil
 }
 
+// Flush sends the headers and the body written so far to the host, which
+// forwards them to the client right away. It implements http.Flusher.
+func (w *Response) Flush() {
+	w.FlushError()
+}
+
+// FlushError is like Flush but reports the error, for http.ResponseController.
+// An error means the client is gone, and the request's context is canceled.
+func (w *Response) FlushError() error {
+	if w.stream == nil || w.conn != nil || (w.err != nil && !w.wroteHeader) {
+		return nil
+	}
+	if err := w.flushBody(); err != nil {
+		return err
+	}
+	if w.capabilities&protocol.CapFlush == 0 {
+		return nil
+	}
+	return w.broken(w.stream.WriteFrame(protocol.FrameFlush, nil))
+}
+
+// flushBody sends the headers frame if needed and the buffered body.
+func (w *Response) flushBody() error {
+	if err := w.writeHead(); err != nil {
+		return err
+	}
+	_, err := w.stream.Write(w.buf)
+	w.buf = w.buf[:0]
+	return w.broken(err)
+}
+
+// broken cancels the request's context if err shows the host stopped reading.
+func (w *Response) broken(err error) error {
+	if err != nil && w.cancel != nil {
+		w.cancel()
+	}
+	return err
+}
+
 func (w *Response) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
 	w.StatusCode = status
 }
+
+// writeHead sends the headers frame before the first body chunk.
+func (w *Response) writeHead() error {
+	if w.wroteHeader {
+		return nil
+	}
+	w.wroteHeader = true
+
+	// A declared Content-Length lets the host answer without chunking.
+	length, _ := strconv.Atoi(w.Headers.Get("Content-Length"))
+	return w.broken(w.stream.WriteMessage(protocol.FrameHeaders, &types.FDResponse{
+		StatusCode:   int32(w.StatusCode),
+		Length:       int32(length),
+		Header:       protocol.FromHeader(w.header()),
+		Version:      w.version,
+		Capabilities: w.capabilities,
+		Error:        w.err.toProto(),
+	}))
+}
+
+// fail records e in place of the response. Once the headers are streamed,
+// e is sent in the trailers instead. Only the first error is kept.
+func (w *Response) fail(e *Error) {
+	if w.err != nil {
+		return
+	}
+	w.err = e
+	if w.wroteHeader {
+		return
+	}
+	w.Body = nil
+	w.buf = nil
+	w.StatusCode = e.Status
+	if w.StatusCode == 0 {
+		w.StatusCode = http.StatusInternalServerError
+	}
+}
+
+// finish sends the headers frame if nothing was written, then the trailers
+// frame ending the response, with the error if it failed while streaming.
+// An upgraded response is ended by closing its WebSocket instead.
+func (w *Response) finish() error {
+	if w.conn != nil {
+		if w.err != nil {
+			return w.conn.WriteMessage(CloseMessage, FormatCloseMessage(CloseInternalServerErr, w.err.Code))
+		}
+		return w.conn.Close()
+	}
+
+	streaming := w.wroteHeader
+	if err := w.flushBody(); err != nil {
+		return err
+	}
+	var e *Error
+	if streaming {
+		e = w.err
+	}
+	return w.stream.WriteTrailers(w.trailers(), e.toProto())
+}
+
+// header returns the headers to send, without the trailers declared in the
+// Trailer header or set with http.TrailerPrefix.
+func (w *Response) header() http.Header {
+	h := make(http.Header, len(w.Headers))
+	for k, v := range w.Headers {
+		if !strings.HasPrefix(k, http.TrailerPrefix) {
+			h[k] = v
+		}
+	}
+	for _, k := range protocol.HeaderTokens(w.Headers, "Trailer") {
+		delete(h, http.CanonicalHeaderKey(k))
+	}
+	return h
+}
+
+// trailers returns the trailers the handler set, as net/http finds them: the
+// headers declared in the Trailer header, and those prefixed with
+// http.TrailerPrefix, which need no declaration.
+func (w *Response) trailers() http.Header {
+	trailer := http.Header{}
+	for _, k := range protocol.HeaderTokens(w.Headers, "Trailer") {
+		k = http.CanonicalHeaderKey(k)
+		if v := w.Headers[k]; len(v) > 0 {
+			trailer[k] = v
+		}
+	}
+	for k, v := range w.Headers {
+		if name, ok := strings.CutPrefix(k, http.TrailerPrefix); ok {
+			name = http.CanonicalHeaderKey(name)
+			trailer[name] = append(trailer[name], v...)
+		}
+	}
+	return trailer
+}
+
+// responseOf returns the *Response w wraps, following Unwrap methods like
+// http.ResponseController does.
+func responseOf(w http.ResponseWriter) (*Response, bool) {
+	for {
+		switch rw := w.(type) {
+		case *Response:
+			return rw, true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Package moduletest serves requests with compiled modules as Ignis runs
+// them, for unit tests. It runs the host in process, unlike package sdktest,
+// which only needs the SDK. Requests and responses are as with sdktest.
+package moduletest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ASparkOfFire/ignis/internal/deployment"
+	"github.com/ASparkOfFire/ignis/internal/local"
+	types "github.com/ASparkOfFire/ignis/internal/proto"
+	"github.com/ASparkOfFire/ignis/internal/protocol"
+	"github.com/ASparkOfFire/ignis/internal/runtime"
+	"github.com/ASparkOfFire/ignis/sdk/sdktest"
+	"github.com/google/uuid"
+)
+
+// Timeout is the deadline of the invocations of modules.
+var Timeout = time.Minute
+
+// Do runs the module at path once with r, as Ignis would run it for a
+// deployment in debug mode, whose problem details include the guest's
+// stderr. Files with the .js extension are run as scripts by the JS engine.
+// An error reported after the response started is returned with the response.
+func Do(path string, r *http.Request) (*http.Response, error) {
+	spec := deployment.Spec{
+		ID:       uuid.New(),
+		Path:     path,
+		Engine:   runtime.RuntimeEngineWASM,
+		Encoding: protocol.Encoding(os.Getenv(protocol.EncodingEnv)),
+		Debug:    true,
+		Timeout:  Timeout,
+		Wasi:     &runtime.WasiConfig{MaxOpenFiles: 1024},
+	}
+	if filepath.Ext(path) == ".js" {
+		spec.Engine = runtime.RuntimeEngineJS
+	}
+	sdktest.Prepare(r)
+
+	res, err := local.Run(spec, r)
+	if err != nil {
+		if res != nil && res.Stderr != "" {
+			return nil, fmt.Errorf("%w\n%s", err, res.Stderr)
+		}
+		return nil, err
+	}
+	if res.Error != nil && !res.Aborted {
+		p := protocol.GuestProblem(&types.FDResponse{StatusCode: int32(res.Status), Error: res.Error})
+		p.Stderr = res.Stderr
+		body, _ := json.Marshal(p) // A Problem always encodes
+		header := http.Header{"Content-Type": {"application/problem+json"}}
+		return sdktest.NewResponse(r, p.Status, header, body, nil), nil
+	}
+	resp := sdktest.NewResponse(r, res.Status, res.Header, res.Body, res.Trailer)
+	if res.Error != nil {
+		return resp, &protocol.GuestError{Err: res.Error}
+	}
+	return resp, nil
+}
@@ -0,0 +1,80 @@
+package moduletest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/ASparkOfFire/ignis/internal/protocol"
+)
+
+// buildExample builds the Go example as the Makefile does and returns the
+// path of its module.
+func buildExample(t *testing.T) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping module build in short mode")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command unavailable")
+	}
+	out := filepath.Join(t.TempDir(), "example.wasm")
+	cmd := exec.Command(goBin, "build", "-tags", "ignis_hostio", "-o", out, "../../../example/go")
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to build the example: %v\n%s", err, b)
+	}
+	return out
+}
+
+func TestDoExample(t *testing.T) {
+	module := buildExample(t)
+	tests := []struct {
+		path     string
+		status   int
+		username string
+	}{
+		{"/api/v1/user/2", http.StatusOK, "CleverEagle99"},
+		{"/api/v1/user/9", http.StatusNotFound, ""},
+	}
+	for _, enc := range []protocol.Encoding{protocol.EncodingProtobuf, protocol.EncodingJSON, protocol.EncodingCBOR} {
+		for _, tt := range tests {
+			t.Run(string(enc)+tt.path, func(t *testing.T) {
+				t.Setenv(protocol.EncodingEnv, string(enc))
+				resp, err := Do(module, httptest.NewRequest(http.MethodGet, tt.path, nil))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp.StatusCode != tt.status {
+					t.Fatalf("status is %d, want %d", resp.StatusCode, tt.status)
+				}
+				if ct := resp.Header.Get("Content-Type"); ct != "application/json; charset=utf-8" {
+					t.Fatalf("Content-Type is %q, want JSON", ct)
+				}
+				var body struct {
+					User struct {
+						Username string `json:"username"`
+					} `json:"user"`
+				}
+				if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+					t.Fatal(err)
+				}
+				if body.User.Username != tt.username {
+					t.Fatalf("username is %q, want %q", body.User.Username, tt.username)
+				}
+			})
+		}
+	}
+}
+
+func TestDoMissingModule(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.wasm")
+	if resp, err := Do(path, httptest.NewRequest(http.MethodGet, "/", nil)); err == nil {
+		t.Fatalf("Do of a missing module returned %d, want an error", resp.StatusCode)
+	}
+}
@@ -0,0 +1,115 @@
+// Package sdktest serves requests with handlers through the protocol Ignis
+// speaks with guests, for unit tests. Requests are built as with
+// httptest.NewRequest; the responses are those clients would receive.
+// Messages are encoded as IGNIS_ENCODING says, protobuf if unset, so tests can
+// cover other encodings with t.Setenv. Package moduletest serves them with
+// compiled modules instead.
+package sdktest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/ASparkOfFire/ignis/internal/protocol"
+	"github.com/ASparkOfFire/ignis/sdk"
+	"github.com/google/uuid"
+)
+
+// Do serves r with h as a guest would under Ignis: r is encoded as the host
+// encodes it and served by sdk.HandleWithIO, whose response is decoded. Guest
+// errors are answered with problem details, as the host answers them. An
+// error reported after the response started is returned with the response.
+func Do(h http.Handler, r *http.Request) (*http.Response, error) {
+	enc, err := protocol.ParseEncoding(os.Getenv(protocol.EncodingEnv))
+	if err != nil {
+		return nil, err
+	}
+	Prepare(r)
+
+	inv := protocol.NewInvocation(uuid.New(), r, 0)
+	stdin, stdinW := io.Pipe()
+	stdout, stdoutW := io.Pipe()
+	reqDone := make(chan struct{})
+	go func() {
+		defer close(reqDone)
+		stdinW.CloseWithError(protocol.WriteRequest(stdinW, r, inv, protocol.MaxVersion, enc))
+	}()
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		sdk.HandleWithIO(h, stdin, stdoutW)
+		stdin.Close() // Unblock the request writer if h did not read the body
+		stdoutW.Close()
+	}()
+	// HandleWithIO exits if it cannot write the response, so stdout is
+	// drained rather than closed.
+	defer func() {
+		io.Copy(io.Discard, stdout)
+		<-served
+		<-reqDone
+	}()
+
+	resp, err := protocol.ReadResponse(stdout, enc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.Head.Error != nil {
+		return problemResponse(r, protocol.GuestProblem(resp.Head)), nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	if _, ok := err.(*protocol.GuestError); !ok && err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	status := int(resp.Head.StatusCode)
+	return NewResponse(r, status, protocol.ToHeader(resp.Head.Header), body, resp.Trailer), err
+}
+
+// Prepare fills in what a server sets on requests and clients may leave out.
+func Prepare(r *http.Request) {
+	if r.RequestURI == "" {
+		r.RequestURI = r.URL.RequestURI()
+	}
+	if r.Host == "" {
+		r.Host = "example.com"
+	}
+	if r.RemoteAddr == "" {
+		r.RemoteAddr = "192.0.2.1:1234"
+	}
+}
+
+// NewResponse builds the response to r the host would send.
+func NewResponse(r *http.Request, status int, header http.Header, body []byte, trailer http.Header) *http.Response {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if header == nil {
+		header = http.Header{}
+	}
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "application/octet-stream")
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Trailer:       trailer,
+		Request:       r,
+	}
+}
+
+// problemResponse builds the problem details response to r the host would send.
+func problemResponse(r *http.Request, p protocol.Problem) *http.Response {
+	body, _ := json.Marshal(p) // A Problem always encodes
+	header := http.Header{"Content-Type": {"application/problem+json"}}
+	return NewResponse(r, p.Status, header, body, nil)
+}
@@ -0,0 +1,70 @@
+package sdktest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ASparkOfFire/ignis/internal/protocol"
+)
+
+func TestDo(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Trailer", "X-Checksum")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, r.Method+" "+r.URL.Path+" "+r.Header.Get("X-Name")+": "+string(body))
+		w.Header().Set("X-Checksum", "ok")
+	})
+
+	for _, enc := range []protocol.Encoding{protocol.EncodingProtobuf, protocol.EncodingJSON, protocol.EncodingCBOR} {
+		t.Run(string(enc), func(t *testing.T) {
+			t.Setenv(protocol.EncodingEnv, string(enc))
+			r := httptest.NewRequest(http.MethodPost, "/greet", strings.NewReader("hello"))
+			r.Header.Set("X-Name", "ignis")
+
+			resp, err := Do(h, r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusCreated || string(body) != "POST /greet ignis: hello" {
+				t.Fatalf("got %d %q, want %d %q", resp.StatusCode, body, http.StatusCreated, "POST /greet ignis: hello")
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != "text/plain" {
+				t.Fatalf("Content-Type is %q, want text/plain", ct)
+			}
+			if v := resp.Trailer.Get("X-Checksum"); v != "ok" {
+				t.Fatalf("X-Checksum trailer is %q, want ok", v)
+			}
+		})
+	}
+}
+
+func TestDoPanic(t *testing.T) {
+	h := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	})
+	resp, err := Do(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusInternalServerError || resp.Header.Get("Content-Type") != "application/problem+json" {
+		t.Fatalf("got %d with Content-Type %q, want a 500 with problem details", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	var p protocol.Problem
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != http.StatusInternalServerError {
+		t.Fatalf("problem has status %d, want %d", p.Status, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,221 @@
+package sdk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/ASparkOfFire/ignis/internal/protocol"
+)
+
+// Message types, as in gorilla/websocket. Pings and pongs are answered by
+// the host and never reach the guest.
+const (
+	TextMessage   = protocol.TextMessage
+	BinaryMessage = protocol.BinaryMessage
+	CloseMessage  = 8
+)
+
+// Close codes defined in RFC 6455, section 11.7.
+const (
+	CloseNormalClosure     = 1000
+	CloseGoingAway         = 1001
+	CloseNoStatusReceived  = protocol.CloseNoStatus
+	CloseAbnormalClosure   = 1006
+	CloseInternalServerErr = 1011
+)
+
+// CloseError is returned by ReadMessage once the client closed the connection.
+type CloseError = protocol.CloseError
+
+// IsCloseError reports whether err is a *CloseError with one of codes.
+func IsCloseError(err error, codes ...int) bool {
+	var ce *CloseError
+	if !errors.As(err, &ce) {
+		return false
+	}
+	for _, code := range codes {
+		if ce.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatCloseMessage formats a close code and text as the data of a CloseMessage.
+func FormatCloseMessage(code int, text string) []byte {
+	return append([]byte{byte(code >> 8), byte(code)}, text...)
+}
+
+// ErrCloseSent is returned when writing to a connection after closing it.
+var ErrCloseSent = errors.New("websocket: close sent")
+
+// Upgrader accepts WebSocket upgrades, like gorilla/websocket's. The host
+// terminates the connection and relays its messages to the guest.
+type Upgrader struct {
+	// Subprotocols lists the supported subprotocols in order of preference.
+	Subprotocols []string
+	// CheckOrigin returns true to accept the request's Origin. If nil, only
+	// requests without Origin or from the same host are accepted.
+	CheckOrigin func(r *http.Request) bool
+}
+
+// Upgrade accepts the WebSocket upgrade of r. responseHeader may set cookies
+// or choose a subprotocol. On failure an error response is written to w.
+func (u *Upgrader) Upgrade(w http.ResponseWriter, r *http.Request, responseHeader http.Header) (*Conn, error) {
+	resp, ok := responseOf(w)
+	if !ok || resp.stream == nil || resp.frames == nil || resp.capabilities&protocol.CapWebSocket == 0 {
+		return nil, u.fail(w, http.StatusNotImplemented, "host did not offer a websocket")
+	}
+	if resp.wroteHeader {
+		return nil, errors.New("websocket: response already written")
+	}
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		return nil, u.fail(w, http.StatusBadRequest, "not a websocket handshake")
+	}
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(r) {
+		return nil, u.fail(w, http.StatusForbidden, "origin not allowed")
+	}
+
+	// Messages follow the request body on the same stream.
+	if _, err := io.Copy(io.Discard, r.Body); err != nil {
+		return nil, err
+	}
+
+	for k, v := range responseHeader {
+		resp.Headers[k] = v
+	}
+	if resp.Headers.Get("Sec-Websocket-Protocol") == "" {
+		if p := u.selectSubprotocol(r); p != "" {
+			resp.Headers.Set("Sec-Websocket-Protocol", p)
+		}
+	}
+	resp.StatusCode = http.StatusSwitchingProtocols
+	if err := resp.writeHead(); err != nil {
+		return nil, err
+	}
+
+	resp.conn = &Conn{r: resp.frames, w: resp.stream, subprotocol: resp.Headers.Get("Sec-Websocket-Protocol")}
+	return resp.conn, nil
+}
+
+// fail answers a rejected upgrade.
+func (u *Upgrader) fail(w http.ResponseWriter, status int, reason string) error {
+	http.Error(w, http.StatusText(status), status)
+	return errors.New("websocket: " + reason)
+}
+
+// selectSubprotocol returns the first of u.Subprotocols the client offered.
+func (u *Upgrader) selectSubprotocol(r *http.Request) string {
+	offered := protocol.HeaderTokens(r.Header, "Sec-Websocket-Protocol")
+	for _, p := range u.Subprotocols {
+		for _, o := range offered {
+			if p == o {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+// Conn is an accepted WebSocket connection. One goroutine may read while
+// others write.
+type Conn struct {
+	r           *protocol.Reader
+	w           *protocol.Writer
+	subprotocol string
+
+	mu        sync.Mutex // Serializes writes
+	closeSent bool
+}
+
+// Subprotocol returns the negotiated subprotocol.
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// ReadMessage reads the next text or binary message. It returns a
+// *CloseError once the client closed the connection.
+func (c *Conn) ReadMessage() (messageType int, p []byte, err error) {
+	return c.r.ReadWebSocketMessage()
+}
+
+// WriteMessage writes a message. A CloseMessage, formatted with
+// FormatCloseMessage, closes the connection.
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closeSent {
+		return ErrCloseSent
+	}
+	switch messageType {
+	case TextMessage, BinaryMessage:
+		return c.w.WriteWebSocketMessage(messageType, data)
+	case CloseMessage:
+		c.closeSent = true
+		code, text := CloseNoStatusReceived, ""
+		if len(data) >= 2 {
+			code, text = int(data[0])<<8|int(data[1]), string(data[2:])
+		}
+		return c.w.WriteWebSocketClose(code, text)
+	default:
+		return fmt.Errorf("websocket: unsupported message type %d", messageType)
+	}
+}
+
+// ReadJSON reads the next message and decodes it as JSON into v.
+func (c *Conn) ReadJSON(v any) error {
+	_, p, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(p, v)
+}
+
+// WriteJSON writes v encoded as JSON in a text message.
+func (c *Conn) WriteJSON(v any) error {
+	p, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(TextMessage, p)
+}
+
+// Close closes the connection normally, unless a close message was already sent.
+func (c *Conn) Close() error {
+	err := c.WriteMessage(CloseMessage, FormatCloseMessage(CloseNormalClosure, ""))
+	if err == ErrCloseSent {
+		return nil
+	}
+	return err
+}
+
+// sameOrigin accepts requests without Origin or whose Origin is the request's host.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// headerContains reports whether a comma-separated header lists token.
+func headerContains(h http.Header, name, token string) bool {
+	for _, t := range protocol.HeaderTokens(h, name) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}